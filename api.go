@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/auth"
+	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/quantumchess"
+	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/websocket"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// API_PREFIX is the path of the versioned REST API
+var API_PREFIX string = "/api/v1"
+
+// DEFAULT_PAGE_SIZE and MAX_PAGE_SIZE bound the number of games listed per page
+var DEFAULT_PAGE_SIZE int = 20
+var MAX_PAGE_SIZE int = 100
+
+// APIError is the body of every error answered by the REST API.
+type APIError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"` // stable machine readable code, e.g. not_found
+	Message string `json:"message"`
+}
+
+// CreateGameRequest is the body of POST /api/v1/games.
+type CreateGameRequest struct {
+	Private     bool   `json:"private"`
+	Spectators  bool   `json:"spectators"`  // whether anyone can watch a private game
+	Variant     string `json:"variant"`     // setup name, defaults to standard
+	TimeControl string `json:"timeControl"` // minutes+increment, empty for no clock
+	Rated       bool   `json:"rated"`       // requires a time control
+	Color       string `json:"color"`       // color of the creator: white, black or random
+}
+
+// CreatedGame is the body answered when a game is created, with the invite token of a private game.
+// The invite is only ever sent to the creator.
+type CreatedGame struct {
+	websocket.RoomInfo
+	Invite string `json:"invite,omitempty"`
+}
+
+// GameList is the body answered by GET /api/v1/games.
+type GameList struct {
+	Games  []websocket.RoomInfo `json:"games"`
+	Total  int                  `json:"total"`
+	Limit  int                  `json:"limit"`
+	Offset int                  `json:"offset"`
+}
+
+// serveAPI routes the requests of the REST API. Creating a game requires a session token signed by signer.
+func serveAPI(rooms *websocket.Rooms, signer *auth.Signer, w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, API_PREFIX), "/")
+	s := strings.Split(path, "/")
+	switch {
+	case len(s) == 1 && s[0] == "games":
+		if r.Method == http.MethodGet {
+			serveListGames(rooms, w, r)
+		} else if r.Method == http.MethodPost {
+			serveCreateGameAPI(rooms, signer, w, r)
+		} else {
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+	case len(s) == 2 && s[0] == "games":
+		if r.Method == http.MethodGet {
+			serveGetGame(rooms, w, s[1])
+		} else {
+			methodNotAllowed(w, http.MethodGet)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "no such endpoint: "+r.URL.Path)
+	}
+}
+
+// POST /api/v1/games with a CreateGameRequest, answers the RoomInfo of the new game.
+// The creator is the authenticated user, who takes the requested color whenever they join.
+func serveCreateGameAPI(rooms *websocket.Rooms, signer *auth.Signer, w http.ResponseWriter, r *http.Request) {
+	creator, err := signer.Verify(auth.RequestToken(r))
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthenticated", err.Error())
+		return
+	}
+	var request CreateGameRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "invalid request body: "+err.Error())
+		return
+	}
+	if request.Variant == "" {
+		request.Variant = "standard"
+	}
+	if request.Rated && request.TimeControl == "" {
+		writeError(w, http.StatusBadRequest, "invalid_time_control", "rated games need a time control")
+		return
+	}
+	gamePool, err := rooms.CreateGame(websocket.RoomOptions{Private: request.Private, Spectators: request.Spectators,
+		Setup: request.Variant, TimeControl: request.TimeControl, Rated: request.Rated, Color: request.Color,
+		Creator: creator})
+	if err != nil {
+		writeCreateError(w, err)
+		return
+	}
+	fmt.Println("Created game", gamePool.ID, "with setup", request.Variant)
+	w.Header().Set("Location", API_PREFIX+"/games/"+gamePool.ID)
+	writeJSON(w, http.StatusCreated, CreatedGame{RoomInfo: gamePool.Info(), Invite: gamePool.Invite()})
+}
+
+// writeCreateError answers the error of a failed room creation.
+func writeCreateError(w http.ResponseWriter, err error) {
+	if err == websocket.ErrNoRoomCode {
+		writeError(w, http.StatusServiceUnavailable, "no_room_code", err.Error())
+	} else if err == websocket.ErrInvalidColor {
+		writeError(w, http.StatusBadRequest, "invalid_color", err.Error())
+	} else if err == websocket.ErrInvalidTimeControl {
+		writeError(w, http.StatusBadRequest, "invalid_time_control", err.Error())
+	} else if _, ok := err.(quantumchess.InvalidSetup); ok {
+		writeError(w, http.StatusBadRequest, "invalid_variant", err.Error())
+	} else {
+		fmt.Println(err)
+		writeError(w, http.StatusInternalServerError, "internal", err.Error())
+	}
+}
+
+// GET /api/v1/games?state=&variant=&timeControl=&limit=&offset=, lists the public games matching every filter given.
+func serveListGames(rooms *websocket.Rooms, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, ok := queryInt(w, query.Get("limit"), "limit", DEFAULT_PAGE_SIZE)
+	if !ok {
+		return
+	}
+	offset, ok := queryInt(w, query.Get("offset"), "offset", 0)
+	if !ok {
+		return
+	}
+	if limit < 1 || limit > MAX_PAGE_SIZE || offset < 0 {
+		writeError(w, http.StatusBadRequest, "invalid_page",
+			fmt.Sprintf("limit must be between 1 and %d and offset must not be negative", MAX_PAGE_SIZE))
+		return
+	}
+
+	games := []websocket.RoomInfo{}
+	for _, game := range rooms.List(false) {
+		if (query.Get("state") == "" || game.State == query.Get("state")) &&
+			(query.Get("variant") == "" || game.Setup == query.Get("variant") || game.Variant == query.Get("variant")) &&
+			(query.Get("timeControl") == "" || game.TimeControl == query.Get("timeControl")) {
+			games = append(games, game)
+		}
+	}
+	list := GameList{Games: []websocket.RoomInfo{}, Total: len(games), Limit: limit, Offset: offset}
+	if offset < len(games) {
+		end := offset + limit
+		if end > len(games) {
+			end = len(games)
+		}
+		list.Games = games[offset:end]
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// GET /api/v1/games/{id}, answers the RoomInfo of a game, private or not.
+func serveGetGame(rooms *websocket.Rooms, w http.ResponseWriter, id string) {
+	gamePool, ok := rooms.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "no game with id "+id)
+		return
+	}
+	writeJSON(w, http.StatusOK, gamePool.Info())
+}
+
+// queryInt parses an integer query parameter, answering an error if it is not one.
+func queryInt(w http.ResponseWriter, value string, name string, defaultValue int) (int, bool) {
+	if value == "" {
+		return defaultValue, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_"+name, name+" must be an integer")
+		return 0, false
+	}
+	return n, true
+}
+
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "allowed methods: "+strings.Join(methods, ", "))
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, APIError{Status: status, Code: code, Message: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		fmt.Println("Unable to encode json data:", err)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/auth"
+	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/websocket"
+)
+
+// apiTest is a request to the server and the answer expected.
+type apiTest struct {
+	method string
+	path   string
+	body   string
+	token  string
+	status int
+	code   string // code of the APIError answered, empty for a success
+}
+
+// run sends the request of the test to handler and checks the status and the error answered.
+// Returns the recorded answer.
+func (test apiTest) run(t *testing.T, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+	if test.token != "" {
+		request.Header.Set("Authorization", "Bearer "+test.token)
+	}
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	name := test.method + " " + test.path
+	if recorder.Code != test.status {
+		t.Errorf("%v: expected status %v, got %v: %v", name, test.status, recorder.Code, recorder.Body)
+		return recorder
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("%v: expected a JSON answer, got %v", name, contentType)
+	}
+	if test.code == "" {
+		return recorder
+	}
+	var apiError APIError
+	if err := json.Unmarshal(recorder.Body.Bytes(), &apiError); err != nil {
+		t.Errorf("%v: %v", name, err)
+	} else if apiError.Status != test.status || apiError.Code != test.code || apiError.Message == "" {
+		t.Errorf("%v: expected a %v %v error, got %+v", name, test.status, test.code, apiError)
+	}
+	return recorder
+}
+
+// TestAPI checks the status codes and the JSON errors of the REST API.
+func TestAPI(t *testing.T) {
+	rooms := websocket.NewRooms()
+	defer rooms.Shutdown()
+	signer := auth.NewSigner([]byte("test key"))
+	token := signer.Issue("alice")
+	game, err := rooms.CreateGame(websocket.RoomOptions{Setup: "standard", Private: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(rooms, signer, w, r)
+	}
+
+	for _, test := range []apiTest{
+		{http.MethodGet, "/api/v1/games", "", "", http.StatusOK, ""},
+		{http.MethodGet, "/api/v1/games?state=waiting&limit=5&offset=1", "", "", http.StatusOK, ""},
+		{http.MethodGet, "/api/v1/games?limit=0", "", "", http.StatusBadRequest, "invalid_page"},
+		{http.MethodGet, "/api/v1/games?offset=first", "", "", http.StatusBadRequest, "invalid_offset"},
+		{http.MethodGet, "/api/v1/games/" + strings.ToLower(game.ID), "", "", http.StatusOK, ""},
+		{http.MethodGet, "/api/v1/games/NOPE", "", "", http.StatusNotFound, "not_found"},
+		{http.MethodGet, "/api/v1/players", "", "", http.StatusNotFound, "not_found"},
+		{http.MethodDelete, "/api/v1/games", "", token, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodPut, "/api/v1/games/" + game.ID, "", token, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodPost, "/api/v1/games", `{}`, "", http.StatusUnauthorized, "unauthenticated"},
+		{http.MethodPost, "/api/v1/games", `{}`, token + "x", http.StatusUnauthorized, "unauthenticated"},
+		{http.MethodPost, "/api/v1/games", `{`, token, http.StatusBadRequest, "invalid_json"},
+		{http.MethodPost, "/api/v1/games", `{"players": 3}`, token, http.StatusBadRequest, "invalid_json"},
+		{http.MethodPost, "/api/v1/games", `{"variant": "unknown"}`, token, http.StatusBadRequest, "invalid_variant"},
+		{http.MethodPost, "/api/v1/games", `{"timeControl": "fast"}`, token, http.StatusBadRequest,
+			"invalid_time_control"},
+		{http.MethodPost, "/api/v1/games", `{"rated": true}`, token, http.StatusBadRequest, "invalid_time_control"},
+		{http.MethodPost, "/api/v1/games", `{"color": "green"}`, token, http.StatusBadRequest, "invalid_color"},
+		{http.MethodPost, "/api/v1/games", `{}`, token, http.StatusCreated, ""},
+		{http.MethodPost, "/api/v1/games", `{"private": true, "variant": "quantum960", "color": "black"}`, token,
+			http.StatusCreated, ""},
+	} {
+		recorder := test.run(t, handler)
+		if test.status != http.StatusCreated || recorder.Code != test.status {
+			continue
+		}
+		var created CreatedGame
+		if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil {
+			t.Fatal(err)
+		}
+		if location := recorder.Header().Get("Location"); location != API_PREFIX+"/games/"+created.ID {
+			t.Errorf("expected the location of game %v, got %v", created.ID, location)
+		}
+		if created.Private != (created.Invite != "") {
+			t.Errorf("expected an invite for private games only, got %+v", created)
+		}
+		if gamePool, ok := rooms.Get(created.ID); !ok || gamePool.Creator != "alice" {
+			t.Errorf("expected game %v to be created by alice", created.ID)
+		}
+	}
+}
+
+// TestCreateGame checks the answers of /create/{private}/{setup}.
+func TestCreateGame(t *testing.T) {
+	rooms := websocket.NewRooms()
+	defer rooms.Shutdown()
+	signer := auth.NewSigner([]byte("test key"))
+	token := signer.Issue("alice")
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		serveCreateGame(rooms, signer, w, r)
+	}
+
+	for _, test := range []apiTest{
+		{http.MethodGet, "/create/true/standard", "", "", http.StatusUnauthorized, "unauthenticated"},
+		{http.MethodGet, "/create/maybe", "", token, http.StatusBadRequest, "invalid_path"},
+		{http.MethodGet, "/create/false/unknown", "", token, http.StatusBadRequest, "invalid_variant"},
+		{http.MethodGet, "/create/true/standard", "", token, http.StatusOK, ""},
+	} {
+		test.run(t, handler)
+	}
+}
@@ -2,4 +2,7 @@ module github.com/alexandreLamarre/Quantum-Chess-Backend
 
 go 1.15
 
-require github.com/gorilla/websocket v1.4.2
+require (
+	github.com/gorilla/websocket v1.4.2
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
+)
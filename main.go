@@ -1,31 +1,54 @@
 package main
 
 import (
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/auth"
 	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/quantum"
+	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/quantumchess"
+	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/rating"
 	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/websocket"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
 //RUN toggles whether or not to start the server
 var RUN bool = true
+
+//SETUPS_DIR is the directory custom setup documents are loaded from at startup
+var SETUPS_DIR string = "setups"
 var rooms *websocket.Rooms = websocket.NewRooms()
+var ratings rating.Store = rating.NewMemoryStore()
+var users auth.UserStore = auth.NewMemoryUserStore()
+
+//TOKEN_KEY_ENV is the environment variable holding the key session tokens are signed with.
+// A random key is generated when it is empty, so tokens do not survive restarts.
+var TOKEN_KEY_ENV string = "QUANTUM_CHESS_TOKEN_KEY"
+
+//Credentials is the JSON body of register and login requests.
+type Credentials struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+//Session is the JSON answer to register and login requests.
+type Session struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+}
 
 func serveWs(pool *websocket.Pool, w http.ResponseWriter, r *http.Request) {
 	//fmt.Println("WebSocket Endpoint Hit")
-	conn, err := websocket.Upgrade(w, r)
+	conn, user, err := websocket.Upgrade(w, r)
 	if err != nil {
-		fmt.Fprintf(w, "%+v\n", err)
-	}
-	//fmt.Println("Request url", r.URL.Path)
-	client := &websocket.Client{
-		ID:   string(r.URL.Path[4:]),
-		Conn: conn,
-		Pool: pool,
+		return
 	}
+	client := websocket.NewClient(user, conn, pool)
 
 	pool.Register <- client
 	client.Read()
@@ -36,54 +59,64 @@ func serveGame(rooms *websocket.Rooms, w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Game Request url", r.URL.Path)
 
 	//create New Game Socket
-	gid, cid := parseGameURL(string(r.URL.Path))
-	fmt.Println("Client id: ", cid, "\n Game id: ", gid)
+	gid := parseGameURL(string(r.URL.Path))
+	fmt.Println("Game id: ", gid)
 
-	var gamePool *websocket.GamePool
-	if rooms.Games[gid] == nil {
+	gamePool, ok := rooms.Get(gid)
+	if !ok {
 		http.Error(w, "Game :"+gid, http.StatusNotFound)
 		return
 	}
 	fmt.Println("Joining new Game", gid)
-	gamePool = rooms.Games[gid]
 
 	fmt.Println("Game Websocket Endpoint Hit")
-	conn, err := websocket.Upgrade(w, r)
+	conn, user, err := websocket.Upgrade(w, r)
 	if err != nil {
-		fmt.Fprintf(w, "%+v\n", err)
+		return
 	}
 
-	gameClient := &websocket.GameClient{
-		ID:       cid,
-		Conn:     conn,
-		GamePool: gamePool,
-	}
+	gameClient := websocket.NewGameClient(user, conn, gamePool)
+	gameClient.Reconnect = r.URL.Query().Get("reconnect")
+	gameClient.Invite = r.URL.Query().Get("invite")
 
-	gamePool.Register <- gameClient
+	if !gamePool.Join(gameClient) {
+		conn.Close()
+		return
+	}
 	gameClient.GameRead()
 }
 
-func parseGameURL(url string) (string, string) {
+//parseGameURL returns the game id of a /game/{gid} url, the client is the authenticated user.
+func parseGameURL(url string) string {
 
-	s := strings.Split(url, "/") // /Game / gid/ cid
+	s := strings.Split(url, "/") // /Game / gid
 	fmt.Println("url parse into", s)
-	return s[2], s[3]
+	for len(s) < 3 {
+		s = append(s, "")
+	}
+	return s[2]
 }
 
 func serveList(rooms *websocket.Rooms, w http.ResponseWriter, r *http.Request) {
 	var ids []string
 	var players []string
 	gameInfo := &websocket.GameInfo{Ids: ids, Players: players}
-	for id, game := range rooms.Games {
-		if rooms.Privacy[id] == false {
-			gameInfo.Ids = append(gameInfo.Ids, id)
-			numPlayers := len(game.Clients)
-			if numPlayers > 2 {
-				numPlayers = 2
-			}
-			gameInfo.Players = append(gameInfo.Players, strconv.Itoa(numPlayers))
-			fmt.Println("id", id, "num_players", numPlayers)
+	for _, game := range rooms.List(false) {
+		gameInfo.Ids = append(gameInfo.Ids, game.ID)
+		numPlayers := game.Players
+		if numPlayers > 2 {
+			numPlayers = 2
+		}
+		gameInfo.Players = append(gameInfo.Players, strconv.Itoa(numPlayers))
+		gameInfo.Spectators = append(gameInfo.Spectators, strconv.Itoa(game.Watching))
+		gameInfo.Setups = append(gameInfo.Setups, game.Setup)
+		setupNumber := ""
+		if game.SetupNumber >= 0 {
+			setupNumber = strconv.FormatInt(game.SetupNumber, 10)
 		}
+		gameInfo.SetupNumbers = append(gameInfo.SetupNumbers, setupNumber)
+		gameInfo.States = append(gameInfo.States, game.State)
+		fmt.Println("id", game.ID, "num_players", numPlayers)
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
@@ -93,47 +126,183 @@ func serveList(rooms *websocket.Rooms, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func serveCreateGame(rooms *websocket.Rooms, w http.ResponseWriter, r *http.Request) {
-	gid, privacy := parseCreateURL(r.URL.Path)
-	fmt.Println("Creating new Game", gid)
-	if rooms.Games[gid] != nil {
-		fmt.Println("Game already exists")
-		w.WriteHeader(409)
+// /leaderboard/category?limit=n, the category defaults to classical and the limit to 100.
+func serveLeaderboard(ratings rating.Store, w http.ResponseWriter, r *http.Request) {
+	s := strings.Split(r.URL.Path, "/")
+	category := rating.CLASSICAL
+	if len(s) > 2 && s[2] != "" {
+		category = s[2]
+	}
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+		limit = l
+	}
+	entries, err := ratings.Leaderboard(category, limit)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
-	gamePool := websocket.NewGamePool(gid)
-	rooms.Privacy[gid] = privacy
-	rooms.Games[gid] = gamePool
-	go gamePool.StartGame()
+	err = json.NewEncoder(w).Encode(entries)
+	if err != nil {
+		fmt.Println("Unable to encode json data for serveLeaderboard")
+	}
 }
 
-func parseCreateURL(url string) (string, bool) {
+// POST /register with Credentials, answers a Session of the new user.
+func serveRegister(signer *auth.Signer, w http.ResponseWriter, r *http.Request) {
+	credentials, ok := readCredentials(w, r)
+	if !ok {
+		return
+	}
+	user, err := auth.Register(users, credentials.Name, credentials.Password)
+	if err == auth.ErrUserExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err == auth.ErrInvalidName || err == auth.ErrWeakPassword {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeSession(signer, w, user.Name, http.StatusCreated)
+}
+
+// POST /login with Credentials, answers a new Session.
+func serveLogin(signer *auth.Signer, w http.ResponseWriter, r *http.Request) {
+	credentials, ok := readCredentials(w, r)
+	if !ok {
+		return
+	}
+	user, err := auth.Login(users, credentials.Name, credentials.Password)
+	if err == auth.ErrInvalidCredentials {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeSession(signer, w, user.Name, http.StatusOK)
+}
+
+func readCredentials(w http.ResponseWriter, r *http.Request) (Credentials, bool) {
+	var credentials Credentials
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return credentials, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		http.Error(w, "invalid credentials document", http.StatusBadRequest)
+		return credentials, false
+	}
+	return credentials, true
+}
+
+func writeSession(signer *auth.Signer, w http.ResponseWriter, name string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(Session{Name: name, Token: signer.Issue(name)})
+	if err != nil {
+		fmt.Println("Unable to encode json data for writeSession")
+	}
+}
+
+//tokenKey returns the key in TOKEN_KEY_ENV, or a random key if it is empty.
+func tokenKey() []byte {
+	if key := os.Getenv(TOKEN_KEY_ENV); key != "" {
+		return []byte(key)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+//serveCreateGame creates a game for the authenticated user, see parseCreateURL.
+func serveCreateGame(rooms *websocket.Rooms, signer *auth.Signer, w http.ResponseWriter, r *http.Request) {
+	creator, err := signer.Verify(auth.RequestToken(r))
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthenticated", err.Error())
+		return
+	}
+	privacy, setup, err := parseCreateURL(r.URL.Path)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_path", err.Error())
+		return
+	}
+	fmt.Println("Creating new Game with setup", setup)
+	gamePool, err := rooms.CreateGame(websocket.RoomOptions{Private: privacy, Setup: setup, Creator: creator})
+	if err != nil {
+		writeCreateError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, CreatedGame{RoomInfo: gamePool.Info(), Invite: gamePool.Invite()})
+}
+
+// /create/privacy/setup, the setup is optional and defaults to the standard setup.
+// quantum960 generates a random Quantum960 setup, quantum960-{number} a specific one.
+// The server picks the code of the game. Prefer POST /api/v1/games.
+func parseCreateURL(url string) (bool, string, error) {
 	s := strings.Split(url, "/")
-	privacy, err := strconv.ParseBool(s[3])
+	if len(s) < 3 {
+		return false, "", fmt.Errorf("expected /create/privacy/setup, got %v", url)
+	}
+	privacy, err := strconv.ParseBool(s[2])
 	if err != nil {
-		fmt.Println("Parse bool error", err)
+		return false, "", fmt.Errorf("privacy must be true or false, got %v", s[2])
+	}
+	setup := "standard"
+	if len(s) > 3 && s[3] != "" {
+		setup = s[3]
 	}
 	fmt.Println("created game with privacy", privacy)
-	return s[2], privacy
+	return privacy, setup, nil
 }
 
 func setupRoutes() {
+	signer := auth.NewSigner(tokenKey())
+	websocket.Authenticate = func(r *http.Request) (string, error) {
+		return signer.Verify(auth.RequestToken(r))
+	}
 	pool := websocket.NewPool()
+	pool.Rooms = rooms
+	rooms.Ratings = ratings
+	pool.Rating = func(id string, timeControl string) (float64, bool) {
+		r, ok, err := ratings.Get(id, rating.Category(timeControl))
+		return r.Rating, ok && err == nil
+	}
 	go pool.Start()
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/ws") {
+		if strings.HasPrefix(r.URL.Path, API_PREFIX+"/") {
+			serveAPI(rooms, signer, w, r)
+		} else if strings.HasPrefix(r.URL.Path, "/ws") {
 			serveWs(pool, w, r)
 		} else if strings.HasPrefix(r.URL.Path, "/game") {
 			fmt.Println("Serving game websocket request")
 			serveGame(rooms, w, r)
 		} else if strings.HasPrefix(r.URL.Path, "/create") {
 			fmt.Println("\n creating new Game")
-			serveCreateGame(rooms, w, r)
+			serveCreateGame(rooms, signer, w, r)
 		} else if strings.HasPrefix(r.URL.Path, "/listgames") {
 			fmt.Println("\n fetching games in progress")
 			serveList(rooms, w, r)
+		} else if r.URL.Path == "/register" {
+			serveRegister(signer, w, r)
+		} else if r.URL.Path == "/login" {
+			serveLogin(signer, w, r)
+		} else if strings.HasPrefix(r.URL.Path, "/leaderboard") {
+			fmt.Println("\n fetching leaderboard")
+			serveLeaderboard(ratings, w, r)
 		}
 	})
 }
@@ -141,8 +310,20 @@ func setupRoutes() {
 func main() {
 	fmt.Println("Quantum Chess App v0.01")
 	quantum.TestAllQuantum()
+	if err := quantumchess.LoadSetupsFromDir(SETUPS_DIR); err != nil {
+		fmt.Println("Unable to load setups:", err)
+	}
+	fmt.Println("Available setups", quantumchess.Setups())
 	setupRoutes()
 	if RUN {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-stop
+			fmt.Println("Closing all games")
+			rooms.Shutdown()
+			os.Exit(0)
+		}()
 		http.ListenAndServe(":8080", nil)
 	}
 }
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPasswordHash checks that password hashes are PBKDF2-HMAC-SHA256, against its published test vectors.
+func TestPasswordHash(t *testing.T) {
+	for _, vector := range []struct {
+		password, salt string
+		iterations     int
+		key            string
+	}{
+		{"password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	} {
+		key, _ := hex.DecodeString(vector.key)
+		hash := PasswordHash{Salt: []byte(vector.salt), Hash: key, Iterations: vector.iterations}
+		if !hash.Matches(vector.password) || hash.Matches("wrong") {
+			t.Errorf("expected only %v to match %v for %d iterations", vector.password, vector.key, vector.iterations)
+		}
+	}
+}
+
+// TestRegisterLogin checks registration and login with right and wrong passwords.
+func TestRegisterLogin(t *testing.T) {
+	PASSWORD_ITERATIONS = 1000
+	store := NewMemoryUserStore()
+	if _, err := Register(store, "alice", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Register(store, "alice", "battery staple"); err != ErrUserExists {
+		t.Errorf("expected ErrUserExists, got %v", err)
+	}
+	if _, err := Register(store, " Alice", "battery staple"); err != ErrUserExists {
+		t.Errorf("expected names to ignore case, got %v", err)
+	}
+	if user, err := Login(store, "ALICE", "correct horse"); err != nil || user.Name != "alice" {
+		t.Errorf("expected alice to log in ignoring case, got %v %v", user, err)
+	}
+	if _, err := Register(store, "bob", "short"); err != ErrWeakPassword {
+		t.Errorf("expected ErrWeakPassword, got %v", err)
+	}
+	if _, err := Register(store, "a b", "long enough"); err != ErrInvalidName {
+		t.Errorf("expected ErrInvalidName, got %v", err)
+	}
+	if user, err := Login(store, "alice", "correct horse"); err != nil || user.Name != "alice" {
+		t.Errorf("expected alice to log in, got %v %v", user, err)
+	}
+	if _, err := Login(store, "alice", "wrong horse"); err != ErrInvalidCredentials {
+		t.Errorf("expected ErrInvalidCredentials, got %v", err)
+	}
+	if _, err := Login(store, "carol", "correct horse"); err != ErrInvalidCredentials {
+		t.Errorf("expected ErrInvalidCredentials, got %v", err)
+	}
+}
+
+// TestToken checks that tokens are bound to their user, key and expiry.
+func TestToken(t *testing.T) {
+	signer := NewSigner([]byte("key"))
+	token := signer.Issue("alice")
+	if name, err := signer.Verify(token); err != nil || name != "alice" {
+		t.Errorf("expected alice, got %v %v", name, err)
+	}
+	if _, err := NewSigner([]byte("other")).Verify(token); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for another key, got %v", err)
+	}
+	forged := signer.Issue("bob")
+	forged = strings.Split(forged, ".")[0] + "." + strings.Split(token, ".")[1]
+	if _, err := signer.Verify(forged); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for a forged token, got %v", err)
+	}
+	signer.now = func() time.Time { return time.Now().Add(2 * TOKEN_TTL) }
+	if _, err := signer.Verify(token); err != ErrExpiredToken {
+		t.Errorf("expected ErrExpiredToken, got %v", err)
+	}
+}
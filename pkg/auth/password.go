@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// PASSWORD_ITERATIONS is the number of PBKDF2 iterations new passwords are hashed with.
+var PASSWORD_ITERATIONS int = 100000
+
+// SALT_LENGTH and KEY_LENGTH are the sizes in bytes of password salts and hashes.
+var (
+	SALT_LENGTH int = 16
+	KEY_LENGTH  int = 32
+)
+
+// PasswordHash is a password hashed with PBKDF2-HMAC-SHA256.
+type PasswordHash struct {
+	Salt       []byte `json:"salt"`
+	Hash       []byte `json:"hash"`
+	Iterations int    `json:"iterations"`
+}
+
+// HashPassword hashes a password with a new random salt.
+func HashPassword(password string) (PasswordHash, error) {
+	salt := make([]byte, SALT_LENGTH)
+	if _, err := rand.Read(salt); err != nil {
+		return PasswordHash{}, err
+	}
+	return PasswordHash{Salt: salt, Hash: pbkdf2.Key([]byte(password), salt, PASSWORD_ITERATIONS, KEY_LENGTH, sha256.New),
+		Iterations: PASSWORD_ITERATIONS}, nil
+}
+
+// Matches checks whether password is the hashed password, in constant time.
+func (h PasswordHash) Matches(password string) bool {
+	key := pbkdf2.Key([]byte(password), h.Salt, h.Iterations, len(h.Hash), sha256.New)
+	return subtle.ConstantTimeCompare(key, h.Hash) == 1
+}
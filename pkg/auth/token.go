@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TOKEN_TTL is how long session tokens are valid for.
+var TOKEN_TTL time.Duration = 24 * time.Hour
+
+// Signer issues and verifies session tokens signed with HMAC-SHA256.
+// A token is the base64 encoding of "name:expiry" followed by a dot and the base64 encoding of its signature.
+type Signer struct {
+	Key []byte
+	TTL time.Duration
+	now func() time.Time
+}
+
+// NewSigner creates a Signer with the given key, issuing tokens valid for TOKEN_TTL.
+func NewSigner(key []byte) *Signer {
+	return &Signer{Key: key, TTL: TOKEN_TTL, now: time.Now}
+}
+
+// Issue returns a new session token for the user with the given name.
+func (signer *Signer) Issue(name string) string {
+	expiry := signer.now().Add(signer.TTL).Unix()
+	payload := base64.RawURLEncoding.EncodeToString([]byte(name + ":" + strconv.FormatInt(expiry, 10)))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signer.sign(payload))
+}
+
+// Verify returns the name of the user a token was issued to.
+// Returns ErrInvalidToken if it was not signed with the key of the signer, ErrExpiredToken if it expired.
+func (signer *Signer) Verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, signer.sign(parts[0])) {
+		return "", ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	separator := strings.LastIndex(string(payload), ":")
+	if separator < 0 {
+		return "", ErrInvalidToken
+	}
+	expiry, err := strconv.ParseInt(string(payload[separator+1:]), 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if signer.now().Unix() >= expiry {
+		return "", ErrExpiredToken
+	}
+	return string(payload[:separator]), nil
+}
+
+// sign returns the signature of a token payload.
+func (signer *Signer) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, signer.Key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// RequestToken returns the session token of a request: the bearer token of its Authorization header,
+// or its token query parameter since browsers cannot set headers on websocket requests.
+func RequestToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
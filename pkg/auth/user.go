@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by registration, login and token verification.
+var (
+	ErrUserExists         = errors.New("user already exists")
+	ErrInvalidName        = errors.New("names are 3 to 20 letters, digits, dashes or underscores")
+	ErrWeakPassword       = errors.New("passwords must have at least 8 characters")
+	ErrInvalidCredentials = errors.New("invalid name or password")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrExpiredToken       = errors.New("expired token")
+)
+
+// MIN_PASSWORD_LENGTH is the minimum number of characters of a password.
+var MIN_PASSWORD_LENGTH int = 8
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]{3,20}$`)
+
+// NormalizeName returns the name an account is registered and looked up under: names ignore case and surrounding
+// spaces, so that "Alice" and "alice" are the same user.
+func NormalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// User is a registered account.
+type User struct {
+	Name     string       `json:"name"` // normalized by NormalizeName
+	Password PasswordHash `json:"password"`
+	Created  time.Time    `json:"created"`
+}
+
+// UserStore keeps the registered users.
+type UserStore interface {
+	// Get returns the user with the given name, false if there is none.
+	Get(name string) (*User, bool, error)
+	// Create adds a user, or returns ErrUserExists if one with the same name exists.
+	Create(user *User) error
+}
+
+// MemoryUserStore is a UserStore that keeps users in memory. It is safe for concurrent use.
+type MemoryUserStore struct {
+	mutex sync.RWMutex
+	users map[string]*User
+}
+
+// NewMemoryUserStore creates an empty MemoryUserStore.
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{users: make(map[string]*User)}
+}
+
+// Get returns the user with the given name, false if there is none.
+func (store *MemoryUserStore) Get(name string) (*User, bool, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	user, ok := store.users[name]
+	return user, ok, nil
+}
+
+// Create adds a user, or returns ErrUserExists if one with the same name exists.
+func (store *MemoryUserStore) Create(user *User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.users[user.Name]; ok {
+		return ErrUserExists
+	}
+	store.users[user.Name] = user
+	return nil
+}
+
+// Register creates a user with the given name, normalized by NormalizeName, and password.
+func Register(store UserStore, name string, password string) (*User, error) {
+	name = NormalizeName(name)
+	if !validName.MatchString(name) {
+		return nil, ErrInvalidName
+	}
+	if len([]rune(password)) < MIN_PASSWORD_LENGTH {
+		return nil, ErrWeakPassword
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	user := &User{Name: name, Password: hash, Created: time.Now()}
+	if err := store.Create(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Login returns the user with the given name if the password is theirs, ErrInvalidCredentials otherwise.
+// The name is normalized by NormalizeName.
+func Login(store UserStore, name string, password string) (*User, error) {
+	user, ok, err := store.Get(NormalizeName(name))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// hash anyway so that unknown names take as long as wrong passwords
+		PasswordHash{Salt: make([]byte, SALT_LENGTH), Hash: make([]byte, KEY_LENGTH), Iterations: PASSWORD_ITERATIONS}.Matches(password)
+		return nil, ErrInvalidCredentials
+	}
+	if !user.Password.Matches(password) {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
@@ -13,18 +13,21 @@ func TestAllQuantum() bool {
 		selectDebug()
 	}
 
-	fmt.Println("==== Gates ====\n")
+	fmt.Println("==== Gates ====")
+	fmt.Println()
 	test := testGates()
 	fmt.Println()
 	fmt.Println("Gates test successful?", test)
 	fmt.Println()
 
-	fmt.Println("==== States ==== \n")
+	fmt.Println("==== States ====")
+	fmt.Println()
 	test2 := testStates()
 	fmt.Println()
 	fmt.Println("States test successful?", test2)
 
-	fmt.Println("==== States n Gates ==== \n")
+	fmt.Println("==== States n Gates ====")
+	fmt.Println()
 	test3 := testGatesAndStates()
 	fmt.Println()
 	fmt.Println("States n Gates test successful?", test3)
@@ -0,0 +1,135 @@
+package quantumchess
+
+// certain is the probability above which an event is considered certain, to absorb rounding errors.
+const certain = 1.0 - 1e-9
+
+// CheckProbability returns the probability that the king of the given color is attacked.
+// Every opposing piece attacks the king with the marginal probability of the states whose moves reach it,
+// weighted by the probability of the piece being on its square. Attackers are treated as independent:
+// entanglement between them is ignored.
+// Returns 0 if the color has no king determined as such.
+func CheckProbability(board *Board, pieces *Pieces, color int) float64 {
+	check := 0.0
+	for _, kingSquare := range kingSquares(board, pieces, color) {
+		safe := 1.0
+		for pos, id := range board.Positions {
+			piece := pieces.List[id]
+			if id == 0 || piece == nil || piece.Color == color {
+				continue
+			}
+			safe *= 1.0 - attackProbability(board, pieces, piece, pos, kingSquare)
+		}
+		check += squareProbability(board, kingSquare) * (1.0 - safe)
+	}
+	if check > 1.0 {
+		return 1.0
+	}
+	return check
+}
+
+// InCertainCheck checks whether the king of the given color can be captured with certainty.
+func InCertainCheck(board *Board, pieces *Pieces, color int) bool {
+	return CheckProbability(board, pieces, color) >= certain
+}
+
+// IsCertainCheckmate checks whether the king of the given color can be captured with certainty,
+// and every legal reply leaves it capturable with certainty.
+func IsCertainCheckmate(board *Board, pieces *Pieces, color int) bool {
+	return InCertainCheck(board, pieces, color) && len(LegalMoves(board, pieces, color)) == 0
+}
+
+// LegalMoves returns the {start, end} moves of the given color that do not leave its king capturable with certainty.
+// Each move is simulated classically, as if the piece moved in every one of its activated states.
+// Split and merge moves, and castling, are not considered.
+func LegalMoves(board *Board, pieces *Pieces, color int) [][2]int {
+	var legal [][2]int
+	for pos, id := range board.Positions {
+		piece := pieces.List[id]
+		if id == 0 || piece == nil || piece.Color != color {
+			continue
+		}
+		moves, err := piece.getMoves(board, pos, pieces)
+		if err != nil {
+			continue
+		}
+		for _, end := range moves {
+			newBoard, newPieces := simulateMove(board, pieces, pos, end)
+			if !InCertainCheck(newBoard, newPieces, color) {
+				legal = append(legal, [2]int{pos, end})
+			}
+		}
+	}
+	return legal
+}
+
+// simulateMove returns copies of board and pieces where the piece on start moved to end, capturing any piece there.
+func simulateMove(board *Board, pieces *Pieces, start int, end int) (*Board, *Pieces) {
+	newBoard := board.Copy()
+	newPieces := pieces.Copy()
+	if captured := newBoard.getID(end); captured != 0 {
+		delete(newPieces.List, captured)
+	}
+	if end == board.EnPassant && newPieces.List[board.getID(start)] != nil {
+		behind := getRow(start)*8 + end%8
+		if captured := newBoard.getID(behind); captured != 0 {
+			delete(newPieces.List, captured)
+			newBoard.Positions[behind] = 0
+		}
+	}
+	move(newBoard, newPieces, start, end)
+	newBoard.EnPassant = 0
+	return newBoard, newPieces
+}
+
+// checkProbabilityOn returns the probability that the king of the given color on start would be attacked on pos.
+func checkProbabilityOn(board *Board, pieces *Pieces, start int, pos int, color int) float64 {
+	if pos != start {
+		board, pieces = simulateMove(board, pieces, start, pos)
+	}
+	return CheckProbability(board, pieces, color)
+}
+
+// attackProbability returns the probability that the piece on pos can move to target.
+func attackProbability(board *Board, pieces *Pieces, piece *Piece, pos int, target int) float64 {
+	total := 0.0
+	attack := 0.0
+	for _, state := range piece.StateSpace {
+		p := probability(piece.State[state])
+		total += p
+		if p == 0 {
+			continue
+		}
+		pieceType, err := GetPieceType(state)
+		if err != nil {
+			continue
+		}
+		if find(pieceType.Moves(pos, piece.Color, board, pieces), target) {
+			attack += p
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return squareProbability(board, pos) * attack / total
+}
+
+// kingSquares returns the squares holding a piece of the given color determined as a King.
+// A king split in the Split variant is on several squares.
+func kingSquares(board *Board, pieces *Pieces, color int) []int {
+	var squares []int
+	for pos, id := range board.Positions {
+		piece := pieces.List[id]
+		if id != 0 && piece != nil && piece.Color == color && determinedAs(piece, "King") {
+			squares = append(squares, pos)
+		}
+	}
+	return squares
+}
+
+// squareProbability returns the probability of the piece on pos really being there.
+func squareProbability(board *Board, pos int) float64 {
+	if board.Occupancy == nil {
+		return 1.0
+	}
+	return probability(board.Occupancy[pos])
+}
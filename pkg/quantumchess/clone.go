@@ -0,0 +1,66 @@
+package quantumchess
+
+// Copy returns a deep copy of the board.
+func (board *Board) Copy() *Board {
+	newBoard := &Board{EnPassant: board.EnPassant, Hash: board.Hash, hashedEnPassant: board.hashedEnPassant}
+	newBoard.Positions = make([]int, len(board.Positions))
+	copy(newBoard.Positions, board.Positions)
+	if board.Occupancy != nil {
+		newBoard.Occupancy = make([][2]float64, len(board.Occupancy))
+		copy(newBoard.Occupancy, board.Occupancy)
+	}
+	if board.hashes != nil {
+		newBoard.hashes = make(map[int]uint64, len(board.hashes))
+		for id, h := range board.hashes {
+			newBoard.hashes[id] = h
+		}
+	}
+	for id := range board.changed {
+		newBoard.markChanged(id)
+	}
+	return newBoard
+}
+
+// Copy returns a deep copy of the pieces.
+func (pieces *Pieces) Copy() *Pieces {
+	newPieces := &Pieces{List: make(map[int]*Piece, len(pieces.List))}
+	for id, piece := range pieces.List {
+		if piece == nil {
+			newPieces.List[id] = nil
+			continue
+		}
+		stateSpace := make([]string, len(piece.StateSpace))
+		copy(stateSpace, piece.StateSpace)
+		newPieces.List[id] = &Piece{
+			Action:       piece.Action,
+			Color:        piece.Color,
+			InitialState: __copyMap(piece.InitialState),
+			StateSpace:   stateSpace,
+			State:        __copyMap(piece.State),
+			Moved:        piece.Moved,
+		}
+	}
+	return newPieces
+}
+
+// Copy returns a deep copy of the entanglements.
+// Pieces sharing an Entanglement still share the same copied Entanglement.
+func (entanglements *Entanglements) Copy() *Entanglements {
+	newEntanglements := &Entanglements{List: make(map[int]*Entanglement, len(entanglements.List))}
+	copied := make(map[*Entanglement]*Entanglement)
+	for id, entanglement := range entanglements.List {
+		if entanglement == nil {
+			newEntanglements.List[id] = nil
+			continue
+		}
+		if copied[entanglement] == nil {
+			elements := make([]int, len(entanglement.Elements))
+			copy(elements, entanglement.Elements)
+			state := make([][2]float64, len(entanglement.State))
+			copy(state, entanglement.State)
+			copied[entanglement] = &Entanglement{Elements: elements, State: state}
+		}
+		newEntanglements.List[id] = copied[entanglement]
+	}
+	return newEntanglements
+}
@@ -0,0 +1,101 @@
+package quantumchess
+
+// PositionDelta lists what changed from one position to another, so that clients holding the first position
+// can update it without receiving the whole second one.
+type PositionDelta struct {
+	Squares   map[int]int          `json:"squares"`             // piece id on each changed square, 0 if it was emptied
+	Occupancy map[int][2]float64   `json:"occupancy,omitempty"` // occupancy of each changed square, Split variant only
+	Pieces    map[int]*PieceChange `json:"pieces"`              // each changed piece, nil if it was captured
+	// Entanglements are the entanglement groups that were formed or changed.
+	// Disentangled are the pieces that were entangled and are not anymore.
+	Entanglements []*Entanglement `json:"entanglements,omitempty"`
+	Disentangled  []int           `json:"disentangled,omitempty"`
+	EnPassant     int             `json:"enPassant"`
+}
+
+// PieceChange is the state of a piece that changed, without its InitialState.
+type PieceChange struct {
+	Action     string                `json:"action"`
+	Color      int                   `json:"color"`
+	StateSpace []string              `json:"stateSpace"`
+	States     map[string][2]float64 `json:"states"`
+	Moved      bool                  `json:"moved"`
+}
+
+// Diff returns the changes from the position before to the position after.
+func Diff(beforeBoard *Board, beforeEntanglements *Entanglements, beforePieces *Pieces,
+	afterBoard *Board, afterEntanglements *Entanglements, afterPieces *Pieces) *PositionDelta {
+	delta := &PositionDelta{
+		Squares:   make(map[int]int),
+		Pieces:    make(map[int]*PieceChange),
+		EnPassant: afterBoard.EnPassant,
+	}
+	for pos, id := range afterBoard.Positions {
+		if beforeBoard.Positions[pos] != id {
+			delta.Squares[pos] = id
+		}
+		if afterBoard.Occupancy != nil && beforeBoard.Occupancy != nil &&
+			roundAmplitude(afterBoard.Occupancy[pos]) != roundAmplitude(beforeBoard.Occupancy[pos]) {
+			if delta.Occupancy == nil {
+				delta.Occupancy = make(map[int][2]float64)
+			}
+			delta.Occupancy[pos] = afterBoard.Occupancy[pos]
+		}
+	}
+
+	for id, before := range beforePieces.List {
+		if before != nil && afterPieces.List[id] == nil {
+			delta.Pieces[id] = nil
+		}
+	}
+	for id, after := range afterPieces.List {
+		if after != nil && !samePiece(beforePieces.List[id], after) {
+			delta.Pieces[id] = &PieceChange{Action: after.Action, Color: after.Color, StateSpace: after.StateSpace,
+				States: after.State, Moved: after.Moved}
+		}
+	}
+
+	changed := make(map[*Entanglement]bool)
+	for id, before := range beforeEntanglements.List {
+		after := afterEntanglements.List[id]
+		if before != nil && after == nil && afterPieces.List[id] != nil {
+			delta.Disentangled = append(delta.Disentangled, id)
+		}
+		if after != nil && !sameEntanglement(before, after) && !changed[after] {
+			changed[after] = true
+			delta.Entanglements = append(delta.Entanglements, after)
+		}
+	}
+	for id, after := range afterEntanglements.List {
+		if _, ok := beforeEntanglements.List[id]; !ok && after != nil && !changed[after] {
+			changed[after] = true
+			delta.Entanglements = append(delta.Entanglements, after)
+		}
+	}
+	return delta
+}
+
+// samePiece checks whether two pieces have the same action, color, states and Moved flag.
+func samePiece(p1 *Piece, p2 *Piece) bool {
+	if p1 == nil || p2 == nil {
+		return p1 == p2
+	}
+	if p1.Action != p2.Action || p1.Color != p2.Color || p1.Moved != p2.Moved || len(p1.StateSpace) != len(p2.StateSpace) {
+		return false
+	}
+	for i, state := range p1.StateSpace {
+		if p2.StateSpace[i] != state || roundAmplitude(p1.State[state]) != roundAmplitude(p2.State[state]) {
+			return false
+		}
+	}
+	return true
+}
+
+// LastDelta returns the changes made by the last move of the game, nil if no move was played.
+func (game *Game) LastDelta() *PositionDelta {
+	if len(game.positions) == 0 {
+		return nil
+	}
+	before := game.positions[len(game.positions)-1]
+	return Diff(before.board, before.entanglements, before.pieces, game.Board, game.Entanglements, game.Pieces)
+}
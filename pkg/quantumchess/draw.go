@@ -0,0 +1,123 @@
+package quantumchess
+
+import (
+	"math"
+)
+
+// Reasons a game ends for.
+var (
+	REASON_CHECKMATE  string = "checkmate"
+	REASON_STALEMATE  string = "stalemate"
+	REASON_REPETITION string = "repetition"
+	REASON_MOVE_LIMIT string = "moveLimit"
+)
+
+// REPETITIONS is the number of times the same position must occur for the game to be drawn.
+var REPETITIONS int = 3
+
+// MOVE_LIMIT is the number of half moves without a capture, a pawn move or a measurement after which the game is drawn.
+var MOVE_LIMIT int = 100
+
+// DrawState tracks the positions reached in a game and the half moves played since the last irreversible move.
+// Positions are identified by their Board.Hash, which does not depend on the ids of the pieces
+// and includes the color to move and the en passant square.
+type DrawState struct {
+	Repetitions   map[uint64]int
+	HalfmoveClock int
+	hashes        []uint64 // hash of each recorded position, for Undo
+	clocks        []int    // half move clock before each recorded position, for Undo
+}
+
+// NewDrawState builds a DrawState starting from the position with the given hash.
+func NewDrawState(hash uint64) *DrawState {
+	return &DrawState{Repetitions: map[uint64]int{hash: 1}}
+}
+
+// Record adds the position reached by a move, identified by its hash, to the draw state.
+// The half move clock is reset if the move was irreversible.
+// Returns REASON_REPETITION or REASON_MOVE_LIMIT if the game is drawn, "" otherwise.
+func (draws *DrawState) Record(hash uint64, irreversible bool) string {
+	draws.hashes = append(draws.hashes, hash)
+	draws.clocks = append(draws.clocks, draws.HalfmoveClock)
+	if irreversible {
+		draws.HalfmoveClock = 0
+	} else {
+		draws.HalfmoveClock++
+	}
+	draws.Repetitions[hash]++
+	if draws.Repetitions[hash] >= REPETITIONS {
+		return REASON_REPETITION
+	}
+	if draws.HalfmoveClock >= MOVE_LIMIT {
+		return REASON_MOVE_LIMIT
+	}
+	return ""
+}
+
+// Undo removes the last recorded position from the draw state, when its move is taken back.
+func (draws *DrawState) Undo() {
+	last := len(draws.hashes) - 1
+	if last < 0 {
+		return
+	}
+	draws.Repetitions[draws.hashes[last]]--
+	draws.HalfmoveClock = draws.clocks[last]
+	draws.hashes = draws.hashes[:last]
+	draws.clocks = draws.clocks[:last]
+}
+
+// IsStalemate checks whether the given color has no legal move while its king is not certainly attacked.
+func IsStalemate(board *Board, pieces *Pieces, color int) bool {
+	return !InCertainCheck(board, pieces, color) && len(LegalMoves(board, pieces, color)) == 0
+}
+
+// Irreversible checks whether the move of the piece on start, from the position before to the position after,
+// captured a piece, moved a pawn or measured a piece. Such moves reset the move limit.
+// In the Split variant merging a piece reduces its squares like a measurement, and resets the move limit too.
+func Irreversible(beforeBoard *Board, beforePieces *Pieces, afterBoard *Board, afterPieces *Pieces, start int) bool {
+	if mover := beforePieces.List[beforeBoard.getID(start)]; mover != nil && nonZero(mover.State["Pawn"]) {
+		return true
+	}
+	beforeSquares := countSquares(beforeBoard)
+	afterSquares := countSquares(afterBoard)
+	for id, before := range beforePieces.List {
+		if before == nil {
+			continue
+		}
+		after := afterPieces.List[id]
+		if after == nil || afterSquares[id] < beforeSquares[id] {
+			return true // captured, or measured on fewer squares
+		}
+		if activatedStates(after) < activatedStates(before) {
+			return true // measured
+		}
+	}
+	return false
+}
+
+// countSquares returns the number of squares each piece id is on.
+func countSquares(board *Board) map[int]int {
+	count := make(map[int]int)
+	for _, id := range board.Positions {
+		if id != 0 {
+			count[id]++
+		}
+	}
+	return count
+}
+
+func activatedStates(piece *Piece) int {
+	count := 0
+	for _, amplitude := range piece.State {
+		if nonZero(amplitude) {
+			count++
+		}
+	}
+	return count
+}
+
+// roundAmplitude rounds an amplitude so that rounding errors do not tell equal positions apart.
+func roundAmplitude(cmplx [2]float64) [2]float64 {
+	// adding 0 turns -0 into 0
+	return [2]float64{math.Round(cmplx[0]*1e6)/1e6 + 0, math.Round(cmplx[1]*1e6)/1e6 + 0}
+}
@@ -34,6 +34,30 @@ type InvalidDeterminedState []string
 // returns the state space of the piece whose state we tried to set
 type InvalidSetState []string
 
+//InvalidVariant is an error returned when a game variant is unknown, or a move is not supported by the board's variant.
+// Returns the name of the variant.
+type InvalidVariant string
+
+//InvalidPieceType is an error returned when a state of a piece is not a registered PieceType.
+// Returns the name of the unknown piece type.
+type InvalidPieceType string
+
+//InvalidSetup is an error returned when a setup definition cannot be loaded or applied.
+// Returns a description of the problem.
+type InvalidSetup string
+
+//InvalidPromotion is an error returned when a pawn cannot be promoted to the requested piece type.
+// Returns the requested piece type.
+type InvalidPromotion string
+
+//InvalidTurn is an error returned when a piece is moved while it is not its color's turn.
+// Returns the square of the piece.
+type InvalidTurn int
+
+//InvalidUndo is an error returned when undoing a move in a game where no move was played.
+// Returns the number of moves in the game's history.
+type InvalidUndo int
+
 func (e InvalidMove) Error() string {
 	return fmt.Sprintf("Illegal move to position %d", e)
 }
@@ -69,3 +93,27 @@ func (e InvalidSetState) Error() string {
 	s := e[:]
 	return fmt.Sprintf("Tried to set state of %v but failed", s)
 }
+
+func (e InvalidVariant) Error() string {
+	return fmt.Sprintf("Unsupported variant: %v", string(e))
+}
+
+func (e InvalidPieceType) Error() string {
+	return fmt.Sprintf("Unregistered piece type: %v", string(e))
+}
+
+func (e InvalidSetup) Error() string {
+	return fmt.Sprintf("Invalid setup: %v", string(e))
+}
+
+func (e InvalidPromotion) Error() string {
+	return fmt.Sprintf("Cannot promote to %v", string(e))
+}
+
+func (e InvalidTurn) Error() string {
+	return fmt.Sprintf("Piece on position %d cannot move: not its turn", e)
+}
+
+func (e InvalidUndo) Error() string {
+	return fmt.Sprintf("No move to undo in a history of %d moves", e)
+}
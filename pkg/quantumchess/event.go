@@ -0,0 +1,43 @@
+package quantumchess
+
+// Types of the events a move reports.
+var (
+	EVENT_MEASUREMENT   string = "measurement"   // a piece collapsed to Outcome, a state or a square, with Probability
+	EVENT_GATE          string = "gate"          // Gate was applied to a piece that is not entangled
+	EVENT_ENTANGLEMENT  string = "entanglement"  // Gate was applied to Elements, which are now entangled
+	EVENT_DISENTANGLING string = "disentangling" // a piece was measured out of its entanglement
+	EVENT_CAPTURE       string = "capture"       // a piece was captured on Square
+)
+
+// Event describes something that happened to a piece during a move, so that clients can animate it.
+type Event struct {
+	Type        string  `json:"type"`
+	Piece       int     `json:"piece"`
+	Square      int     `json:"square"`
+	Outcome     string  `json:"outcome,omitempty"`
+	Probability float64 `json:"probability,omitempty"`
+	Gate        string  `json:"gate,omitempty"`
+	Elements    []int   `json:"elements,omitempty"`
+}
+
+// record adds an event to the events of the move being applied.
+func (board *Board) record(event Event) {
+	board.events = append(board.events, event)
+}
+
+// takeEvents returns the events recorded since the last call.
+func (board *Board) takeEvents() []Event {
+	events := board.events
+	board.events = nil
+	return events
+}
+
+// squareOf returns the first square the piece with the given id is on, -1 if it is not on the board.
+func (board *Board) squareOf(id int) int {
+	for pos, pid := range board.Positions {
+		if pid == id {
+			return pos
+		}
+	}
+	return -1
+}
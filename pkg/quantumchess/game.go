@@ -0,0 +1,261 @@
+package quantumchess
+
+import (
+	"math/rand"
+)
+
+// Move describes a move of a Game.
+// A standard move goes from Start to End, a split move from Start onto both Targets,
+// and a merge move from both Targets onto End.
+type Move struct {
+	Type      int    `json:"type"` // STANDARD_MOVE, SPLIT_MOVE or MERGE_MOVE
+	Start     int    `json:"start"`
+	End       int    `json:"end"`
+	Targets   [2]int `json:"targets"`
+	Promotion string `json:"promotion"` // piece type a pawn reaching the last rank becomes, defaults to Queen
+}
+
+// MoveResult records a move applied to a Game.
+type MoveResult struct {
+	Move         Move   `json:"move"`
+	Color        int    `json:"color"`        // color of the player who moved
+	Captured     []int  `json:"captured"`     // ids of the pieces captured by the move
+	Irreversible bool   `json:"irreversible"` // the move captured a piece, moved a pawn or measured a piece
+	Hash         uint64  `json:"hash"`         // hash of the position after the move
+	Events       []Event `json:"events"`       // measurements, gates, entanglements and captures of the move
+}
+
+// Game owns a position, the color to move, the history of the moves played and the source of its measurements.
+// Measurements are drawn from a source seeded with Seed, so that replaying the same moves gives the same results.
+type Game struct {
+	Board         *Board
+	Entanglements *Entanglements
+	Pieces        *Pieces
+	ToMove        int
+	History       []MoveResult
+	Seed          int64
+
+	rng       *gameRand
+	positions []position // positions before each move of History
+}
+
+// position is a copy of the state of a game, restored by Undo.
+type position struct {
+	board         *Board
+	entanglements *Entanglements
+	pieces        *Pieces
+	toMove        int
+	draws         int
+}
+
+// gameRand is a seeded source of random numbers that counts its draws, so that it can be rewound.
+type gameRand struct {
+	seed  int64
+	draws int
+	rng   *rand.Rand
+}
+
+func newGameRand(seed int64, draws int) *gameRand {
+	r := &gameRand{seed: seed, rng: rand.New(rand.NewSource(seed))}
+	for r.draws < draws {
+		r.Float64()
+	}
+	return r
+}
+
+// Float64 returns the next random number in [0, 1).
+func (r *gameRand) Float64() float64 {
+	r.draws++
+	return r.rng.Float64()
+}
+
+// NewGame builds a game starting from the named setup, white to move, with measurements drawn from seed.
+// Returns an error if the setup is not registered.
+func NewGame(setup string, seed int64) (*Game, error) {
+	definition, err := GetSetup(setup)
+	if err != nil {
+		return nil, err
+	}
+	game := &Game{Board: &Board{}, Entanglements: &Entanglements{}, Pieces: &Pieces{}, ToMove: WHITE, Seed: seed}
+	if err := ApplySetup(definition, game.Board, game.Entanglements, game.Pieces); err != nil {
+		return nil, err
+	}
+	game.rng = newGameRand(seed, 0)
+	game.Board.rng = game.rng
+	return game, nil
+}
+
+// Clone returns a deep copy of the game. Both games draw the same measurements from then on.
+func (game *Game) Clone() *Game {
+	clone := &Game{
+		Board:         game.Board.Copy(),
+		Entanglements: game.Entanglements.Copy(),
+		Pieces:        game.Pieces.Copy(),
+		ToMove:        game.ToMove,
+		History:       append([]MoveResult{}, game.History...),
+		Seed:          game.Seed,
+		positions:     append([]position{}, game.positions...), // positions are never modified, they can be shared
+	}
+	// games not built by NewGame have no source, their boards measure with the global source of math/rand
+	if game.rng != nil {
+		clone.rng = newGameRand(game.Seed, game.rng.draws)
+	}
+	clone.Board.rng = clone.rng
+	return clone
+}
+
+// Apply applies a move of the color to move, and passes the turn to the other color.
+// The game is left unchanged if the move fails.
+// Returns the record of the move, or an error if it is not a valid move of the color to move.
+func (game *Game) Apply(move Move) (MoveResult, error) {
+	start := move.Start
+	if move.Type == MERGE_MOVE {
+		start = move.Targets[0]
+	}
+	if !inBoard(start) {
+		return MoveResult{}, InvalidPiece(start)
+	}
+	piece := game.Pieces.List[game.Board.getID(start)]
+	if piece == nil {
+		return MoveResult{}, InvalidPiece(start)
+	}
+	if piece.Color != game.ToMove {
+		return MoveResult{}, InvalidTurn(start)
+	}
+	if err := checkMove(game.Board, game.Pieces, move); err != nil {
+		return MoveResult{}, err
+	}
+
+	before := game.snapshot()
+	events, err := applyMove(game.Board, game.Entanglements, game.Pieces, move)
+	if err != nil {
+		game.restore(before)
+		return MoveResult{}, err
+	}
+
+	result := MoveResult{
+		Move:         move,
+		Color:        game.ToMove,
+		Irreversible: Irreversible(before.board, before.pieces, game.Board, game.Pieces, start),
+		Hash:         game.Board.Hash,
+		Events:       events,
+	}
+	for id := range before.pieces.List {
+		if _, ok := game.Pieces.List[id]; !ok {
+			result.Captured = append(result.Captured, id)
+		}
+	}
+	game.ToMove = 1 - game.ToMove
+	game.History = append(game.History, result)
+	game.positions = append(game.positions, before)
+	return result, nil
+}
+
+// checkMove checks that the squares of a move are on the board, and that the moving piece can reach its destinations:
+// End for a standard move, both Targets for a split move, and End from both Targets for a merge move.
+// Returns an InvalidMove error otherwise.
+func checkMove(board *Board, pieces *Pieces, move Move) error {
+	for _, square := range []int{move.Start, move.End, move.Targets[0], move.Targets[1]} {
+		if !inBoard(square) {
+			return InvalidMove(square)
+		}
+	}
+	var paths [][2]int
+	if move.Type == SPLIT_MOVE {
+		paths = [][2]int{{move.Start, move.Targets[0]}, {move.Start, move.Targets[1]}}
+	} else if move.Type == MERGE_MOVE {
+		paths = [][2]int{{move.Targets[0], move.End}, {move.Targets[1], move.End}}
+	} else {
+		paths = [][2]int{{move.Start, move.End}}
+	}
+	for _, path := range paths {
+		if path[0] != path[1] && !reachable(board, pieces, path[0], path[1]) {
+			return InvalidMove(path[1])
+		}
+	}
+	return nil
+}
+
+// reachable checks whether the piece on start can move to end in one of its activated states, castling included.
+// In the Split variant pieces in uncertain positions between start and end do not block the move, they are measured
+// by it, and another part of the moving piece on end is merged with it.
+func reachable(board *Board, pieces *Pieces, start int, end int) bool {
+	id := board.getID(start)
+	if piece := pieces.List[id]; piece != nil && determinedAs(piece, "King") &&
+		getRow(start) == getRow(end) && (end-start == 2 || end-start == -2) {
+		return true // castle checks the rest of castling
+	}
+	if board.Occupancy != nil {
+		resolved := board.Copy()
+		for _, square := range pathBetween(start, end) {
+			if occupancyUncertain(board, square) {
+				resolved.Positions[square] = 0
+			}
+		}
+		if board.getID(end) == id {
+			resolved.Positions[end] = 0
+		}
+		board = resolved
+	}
+	moves, err := PossibleMoves(board, pieces, start)
+	if err != nil {
+		return false
+	}
+	for _, square := range moves {
+		if square == end {
+			return true
+		}
+	}
+	return false
+}
+
+// applyMove applies a move of any type to a position, and returns its events.
+func applyMove(board *Board, entanglements *Entanglements, pieces *Pieces, move Move) ([]Event, error) {
+	if move.Type == SPLIT_MOVE {
+		return ApplySplitMove(board, entanglements, pieces, move.Start, move.Targets[0], move.Targets[1])
+	} else if move.Type == MERGE_MOVE {
+		return ApplyMergeMove(board, entanglements, pieces, move.Targets[0], move.Targets[1], move.End)
+	}
+	return ApplyPromotionMove(board, entanglements, pieces, move.Start, move.End, move.Promotion)
+}
+
+// Undo takes back the last move, measurements included.
+// The Board, Entanglements and Pieces of the game are restored in place.
+// Returns an error if no move was played.
+func (game *Game) Undo() error {
+	if len(game.History) == 0 {
+		return InvalidUndo(0)
+	}
+	last := len(game.History) - 1
+	game.restore(game.positions[last])
+	game.History = game.History[:last]
+	game.positions = game.positions[:last]
+	return nil
+}
+
+// snapshot copies the state of the game.
+func (game *Game) snapshot() position {
+	p := position{
+		board:         game.Board.Copy(),
+		entanglements: game.Entanglements.Copy(),
+		pieces:        game.Pieces.Copy(),
+		toMove:        game.ToMove,
+	}
+	if game.rng != nil {
+		p.draws = game.rng.draws
+	}
+	return p
+}
+
+// restore sets the state of the game back to a snapshot, rewinding its measurements if it has a source.
+// The snapshot is copied again, it can be restored several times.
+func (game *Game) restore(p position) {
+	*game.Board = *p.board.Copy()
+	*game.Entanglements = *p.entanglements.Copy()
+	*game.Pieces = *p.pieces.Copy()
+	game.ToMove = p.toMove
+	if game.rng != nil {
+		game.rng = newGameRand(game.Seed, p.draws)
+	}
+	game.Board.rng = game.rng
+}
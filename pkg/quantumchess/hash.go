@@ -0,0 +1,152 @@
+package quantumchess
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// Salts keeping the components of a piece's hash apart, so that they cannot cancel each other out.
+const (
+	hashSaltStates       uint64 = 0x9e3779b97f4a7c15
+	hashSaltSquares      uint64 = 0xbf58476d1ce4e5b9
+	hashSaltEntanglement uint64 = 0x94d049bb133111eb
+	hashSideToMove       uint64 = 0x2545f4914f6cdd1d
+	hashSaltEnPassant    uint64 = 0xd6e8feb86659fd93
+)
+
+// InitHash computes the hash of a position from scratch and stores it in board.Hash.
+// A position is hashed as the XOR of the hashes of its pieces, so that a move only rehashes the pieces it changes:
+// move, processCapture and the measurements mark the pieces they change, and the hash is updated once the move is applied.
+// toMove is the color to move, the hash changes after every move of a player.
+// The en passant square is part of the hash: the same pieces with a different en passant square are a different position.
+func (board *Board) InitHash(entanglements *Entanglements, pieces *Pieces, toMove int) {
+	board.Hash = 0
+	board.hashes = make(map[int]uint64)
+	board.changed = nil
+	for id := range pieces.List {
+		board.hashes[id] = pieceHash(board, entanglements, pieces, id)
+		board.Hash ^= board.hashes[id]
+	}
+	board.Hash ^= enPassantHash(board.EnPassant)
+	board.hashedEnPassant = board.EnPassant
+	if toMove == BLACK {
+		board.Hash ^= hashSideToMove
+	}
+}
+
+// markChanged marks the piece with the given id to be rehashed by updateHash.
+func (board *Board) markChanged(ids ...int) {
+	if board.changed == nil {
+		board.changed = make(map[int]bool)
+	}
+	for _, id := range ids {
+		if id != 0 {
+			board.changed[id] = true
+		}
+	}
+}
+
+// updateHash rehashes the pieces changed since the last update, and the en passant square if it changed.
+// If turn is true the move was played, and the color to move changes.
+func (board *Board) updateHash(entanglements *Entanglements, pieces *Pieces, turn bool) {
+	if board.hashes == nil {
+		board.hashes = make(map[int]uint64)
+	}
+	for id := range board.changed {
+		board.Hash ^= board.hashes[id]
+		board.hashes[id] = pieceHash(board, entanglements, pieces, id)
+		board.Hash ^= board.hashes[id]
+	}
+	board.changed = nil
+	if board.EnPassant != board.hashedEnPassant {
+		board.Hash ^= enPassantHash(board.hashedEnPassant) ^ enPassantHash(board.EnPassant)
+		board.hashedEnPassant = board.EnPassant
+	}
+	if turn {
+		board.Hash ^= hashSideToMove
+	}
+}
+
+// pieceHash hashes the color, action, Moved flag and quantized amplitudes of a piece, the squares it is on with their
+// occupancy, and its place in its entanglement. It does not depend on the id of the piece.
+// Returns 0 if the piece is not on the board anymore.
+func pieceHash(board *Board, entanglements *Entanglements, pieces *Pieces, id int) uint64 {
+	piece := pieces.List[id]
+	if piece == nil {
+		return 0
+	}
+
+	var squares uint64
+	found := false
+	for pos, pid := range board.Positions {
+		if pid != id {
+			continue
+		}
+		found = true
+		occupancy := [2]float64{1.0, 0.0}
+		if board.Occupancy != nil {
+			occupancy = board.Occupancy[pos]
+		}
+		squares ^= mix64(uint64(pos+1) ^ amplitudeHash(occupancy))
+	}
+	if !found {
+		return 0
+	}
+
+	moved := uint64(0)
+	if piece.Moved {
+		moved = 1
+	}
+	h := mix64(stringHash(piece.Action) ^ uint64(piece.Color)<<1 ^ moved)
+
+	var states uint64
+	for _, state := range piece.StateSpace {
+		states ^= mix64(stringHash(state) ^ amplitudeHash(piece.State[state]))
+	}
+	h ^= mix64(states ^ hashSaltStates)
+	h ^= mix64(squares ^ hashSaltSquares)
+
+	if entanglements != nil && entanglements.List[id] != nil {
+		entanglement := entanglements.List[id]
+		group := uint64(len(entanglement.Elements))
+		for _, amplitude := range entanglement.State {
+			group = mix64(group ^ amplitudeHash(amplitude))
+		}
+		for i, element := range entanglement.Elements {
+			if element == id {
+				h ^= mix64(group ^ uint64(i+1)<<32 ^ hashSaltEntanglement)
+			}
+		}
+	}
+	return h
+}
+
+// enPassantHash hashes an en passant square, 0 when there is none.
+func enPassantHash(square int) uint64 {
+	if square == 0 {
+		return 0
+	}
+	return mix64(uint64(square) ^ hashSaltEnPassant)
+}
+
+// amplitudeHash hashes an amplitude quantized to 6 decimals, so that rounding errors do not change the hash.
+func amplitudeHash(cmplx [2]float64) uint64 {
+	rounded := roundAmplitude(cmplx)
+	return mix64(uint64(int64(math.Round(rounded[0]*1e6)))) ^ mix64(uint64(int64(math.Round(rounded[1]*1e6)))+1)
+}
+
+func stringHash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// mix64 is the finalizer of splitmix64, it spreads every bit of x over the result.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -3,7 +3,6 @@ package quantumchess
 import (
 	"fmt"
 	"math"
-	"math/rand"
 )
 
 // DEBUGAPPLYMOVE toggles debug messages for the apply move function.
@@ -13,39 +12,82 @@ var DEBUGAPPLYMOVE bool = true
 var ACTIONS [7]string = [7]string{"None", "Hadamard", "PauliX", "PauliZ", "Measurement", "PauliY", "SqrtNOT"}
 
 //ApplyMove applies a move to a board state : (board, entanglements, pieces)
-// and updates its components in place.
-// Returns nil if successful and an appropriate error if the assumptions are not met.
+// and updates its components in place. Pawns reaching the last rank are promoted to a Queen.
+// Returns the events of the move: measurements, gates, entanglements and captures,
+// and nil if successful or an appropriate error if the assumptions are not met.
 func ApplyMove(board *Board, entanglements *Entanglements, pieces *Pieces,
-	startSquare int, endSquare int) (err error) {
+	startSquare int, endSquare int) (events []Event, err error) {
+	return ApplyPromotionMove(board, entanglements, pieces, startSquare, endSquare, "Queen")
+}
+
+//ApplyPromotionMove applies a move like ApplyMove, promoting the Pawn branch of the moved piece
+// to the promotion piece type if it reaches the last rank. An empty promotion defaults to a Queen.
+// Returns the events of the move, and nil if successful or an appropriate error if the assumptions are not met.
+func ApplyPromotionMove(board *Board, entanglements *Entanglements, pieces *Pieces,
+	startSquare int, endSquare int, promotion string) (events []Event, err error) {
+	board.events = nil
+	defer func() {
+		board.updateHash(entanglements, pieces, err == nil)
+		events = board.takeEvents()
+	}()
+	if promotion == "" {
+		promotion = "Queen"
+	}
+	if err := validPromotion(promotion); err != nil {
+		return nil, err
+	}
 	if DEBUGAPPLYMOVE {
 		fmt.Println("Applying move from ", startSquare, " to ", endSquare)
 	}
 
+	// an en passant capture is only available for one move
+	enPassantSquare := board.EnPassant
+	board.EnPassant = 0
+
+	// SPLIT VARIANT: MEASURE UNCERTAIN SQUARES THE MOVE DEPENDS ON
+	if board.Occupancy != nil {
+		proceed, err := resolveOccupancy(board, pieces, startSquare, endSquare)
+		if err != nil || !proceed {
+			return nil, err
+		}
+	}
+
+	// SPECIAL MOVES: CASTLING AND EN PASSANT
+	handled, err := castle(board, entanglements, pieces, startSquare, endSquare)
+	if err != nil || handled {
+		return nil, err
+	}
+	handled, err = enPassant(board, entanglements, pieces, startSquare, endSquare, enPassantSquare)
+	if err != nil || handled {
+		return nil, err
+	}
+	doublePush := doublePushSquare(board, pieces, startSquare, endSquare)
+
 	// CHECK CAPTURE
 	movedPiece := board.Positions[startSquare]
 	potentialPiece := board.Positions[endSquare]
 	if DEBUGAPPLYMOVE {fmt.Println("Checking capture")}
 	capture, err := checkCapture(pieces, movedPiece, potentialPiece)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if capture {
 		if DEBUGAPPLYMOVE{ fmt.Println("A capture has occurred")}
 		piece1, piece2 := board.getID(startSquare), board.getID(endSquare)
 		if piece1 == 0 {
-			return InvalidPiece(startSquare)
+			return nil, InvalidPiece(startSquare)
 		}
 		if piece2 == 0 {
-			return InvalidPiece(endSquare)
+			return nil, InvalidPiece(endSquare)
 		}
 
 		if DEBUGAPPLYMOVE{fmt.Println("Measuring pieces involved in capture")}
-		measure2(pieces, entanglements, piece1, piece2)
+		measure2(board, pieces, entanglements, piece1, piece2)
 		if DEBUGAPPLYMOVE {fmt.Println("Processing captures...")}
 		err := processCapture(board, entanglements, pieces, endSquare)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if DEBUGAPPLYMOVE {fmt.Println("Moving")}
 		move(board, pieces, startSquare, endSquare)
@@ -54,15 +96,15 @@ func ApplyMove(board *Board, entanglements *Entanglements, pieces *Pieces,
 		if DEBUGAPPLYMOVE{ fmt.Println("A capture has not occured")}
 		piece1 := board.getID(startSquare)
 		if piece1 == 0 {
-			return InvalidPiece(startSquare)
+			return nil, InvalidPiece(startSquare)
 		}
 		piece := pieces.List[piece1]
 		if piece == nil {
-			return InvalidPieceAccess(piece1)
+			return nil, InvalidPieceAccess(piece1)
 		}
 		action := piece.getAction()
 		if !validAction(action) {
-			return InvalidAction(action)
+			return nil, InvalidAction(action)
 		}
 		if DEBUGAPPLYMOVE{fmt.Println("parsing actions....", action)}
 		if action == "None" {
@@ -72,7 +114,7 @@ func ApplyMove(board *Board, entanglements *Entanglements, pieces *Pieces,
 			if DEBUGAPPLYMOVE {fmt.Println("Measuring AoF")}
 			AoF, err := piece.getAreaOfInfluence(board, endSquare, pieces)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			measureOnAoF(board, entanglements, pieces, AoF)
 			move(board, pieces, startSquare, endSquare)
@@ -80,11 +122,11 @@ func ApplyMove(board *Board, entanglements *Entanglements, pieces *Pieces,
 			if DEBUGAPPLYMOVE{fmt.Println("Update entanglements based on circuits")}
 			AoF, err := piece.getAreaOfInfluence(board, endSquare, pieces)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			eErr:= updateEntanglements(board, entanglements, pieces, piece1, action, AoF)
 			if eErr != nil{
-				return err
+				return nil, err
 			}
 			if DEBUGAPPLYMOVE{fmt.Println("Moving")}
 			move(board, pieces, startSquare, endSquare)
@@ -94,7 +136,10 @@ func ApplyMove(board *Board, entanglements *Entanglements, pieces *Pieces,
 		}
 	}
 
-	return nil
+	board.EnPassant = doublePush
+
+	// PROMOTE PAWNS REACHING THE LAST RANK
+	return nil, promote(board, entanglements, pieces, endSquare, promotion)
 }
 
 //checkCapture checks whether or not moving a piece from start square to end square will
@@ -117,49 +162,52 @@ func checkCapture(pieces *Pieces, startSquare int, endSquare int) (capture bool,
 func measureOnAoF(board *Board, entanglements *Entanglements, pieces *Pieces, aof map[int]bool) {
 	for square := range aof {
 		id := board.getID(square)
-		measure(pieces, entanglements, id)
+		measure(board, pieces, entanglements, id)
 
 	}
 }
 
 //measure2 measures the states of all pieces entangled to piece1 and piece2.
 // piece1 and piece2 are ids of the pieces being checked.
-func measure2(pieces *Pieces, entanglements *Entanglements, piece1 int, piece2 int) {
+func measure2(board *Board, pieces *Pieces, entanglements *Entanglements, piece1 int, piece2 int) {
 	// if the pieces share entanglements perform measure on the only entangled systems
 	if entanglements.List[piece2] != nil && find(entanglements.List[piece2].Elements, piece1) {
-		measure(pieces, entanglements, piece2)
+		measure(board, pieces, entanglements, piece2)
 	} else { // perform measure on both separate entangled systems
-		measure(pieces, entanglements, piece1)
-		measure(pieces, entanglements, piece2)
+		measure(board, pieces, entanglements, piece1)
+		measure(board, pieces, entanglements, piece2)
 	}
 
 }
 
 //measure1 measures the states of all pieces entangled to piece
-func measure(pieces *Pieces, entanglements *Entanglements, piece int) {
+func measure(board *Board, pieces *Pieces, entanglements *Entanglements, piece int) {
+	elements := []int{piece}
+	if entanglements.List[piece] != nil {
+		elements = entanglements.List[piece].Elements
+	}
 
-	for _, v := range entanglements.List[piece].Elements {
-		if len(pieces.List[piece].StateSpace) == 1 {
+	for _, v := range elements {
+		board.markChanged(v)
+		if entanglements.List[v] != nil {
+			board.record(Event{Type: EVENT_DISENTANGLING, Piece: v, Square: board.squareOf(v)})
+		}
+		entanglements.List[v] = nil //reset their entanglements
+		if pieces.List[v] == nil || len(pieces.List[v].StateSpace) == 1 {
 			continue
 		}
-		randInteger := rand.Float64()
-		cur := 0.0
-		maxProb := ""
-		selected := ""
-		for state, c := range pieces.List[v].State {
-			pr := modulus(c)
-			if pr > cur {
-				maxProb = state
-			}
-			cur += pr
-			if randInteger < cur {
-				selected = state
-				break
-			}
+		// StateSpace order keeps seeded measurements reproducible
+		probabilities := make([]float64, len(pieces.List[v].StateSpace))
+		total := 0.0
+		for i, state := range pieces.List[v].StateSpace {
+			probabilities[i] = probability(pieces.List[v].State[state])
+			total += probabilities[i]
 		}
-		//if a rounding error occurs, it selects the max probability result
-		if selected == "" {
-			selected = maxProb
+		index := board.choose(probabilities)
+		selected := pieces.List[v].StateSpace[index]
+		if total > 0 {
+			board.record(Event{Type: EVENT_MEASUREMENT, Piece: v, Square: board.squareOf(v), Outcome: selected,
+				Probability: probabilities[index] / total})
 		}
 
 		for state := range pieces.List[v].State {
@@ -169,8 +217,8 @@ func measure(pieces *Pieces, entanglements *Entanglements, piece int) {
 				pieces.List[v].State[state] = [2]float64{0.0, 0.0}
 			}
 		}
-		entanglements.List[piece] = nil //reset their entanglements
 	}
+	entanglements.List[piece] = nil
 }
 
 func modulus(cmplx [2]float64) float64 {
@@ -187,9 +235,14 @@ func processCapture(board *Board, entanglements *Entanglements,
 	if !validDelete {
 		return InvalidEntanglementDelete(pieceToDeleteID)
 	}
+	board.markChanged(pieceToDeleteID)
+	board.record(Event{Type: EVENT_CAPTURE, Piece: pieceToDeleteID, Square: endSquare})
 	delete(entanglements.List, pieceToDeleteID)
 	delete(pieces.List, pieceToDeleteID)
 	board.Positions[endSquare] = 0
+	if board.Occupancy != nil {
+		board.Occupancy[endSquare] = [2]float64{0.0, 0.0}
+	}
 	return nil
 }
 
@@ -198,6 +251,9 @@ func processCapture(board *Board, entanglements *Entanglements,
 // else false
 func checkNotEntangled(entanglements *Entanglements, id int) bool {
 	for _, els := range entanglements.List {
+		if els == nil {
+			continue
+		}
 		for _, pid := range els.Elements {
 			if pid == id {
 				return false
@@ -214,6 +270,10 @@ func updateEntanglements(board *Board, entanglements *Entanglements, pieces *Pie
 	kroneckerProductStack := make([][][2]float64, 0, 0)
 	idStack := make([]int, 0, 0)
 	entanglements.List[pieceId] = &Entanglement{}
+	board.markChanged(pieceId)
+	for square := range aof {
+		board.markChanged(board.getID(square))
+	}
 
 	// append to Entangled elements recursively while checking not to add duplicates
 	if DEBUGAPPLYMOVE{fmt.Println("Checking AoF on...")}
@@ -234,6 +294,7 @@ func updateEntanglements(board *Board, entanglements *Entanglements, pieces *Pie
 					i++
 				}
 				if DEBUGAPPLYMOVE{fmt.Println("State resulting from quantum action", pieces.List[pid].State)}
+				board.record(Event{Type: EVENT_GATE, Piece: pid, Square: id, Gate: action})
 			}
 
 		} else {
@@ -279,7 +340,7 @@ func updateEntanglements(board *Board, entanglements *Entanglements, pieces *Pie
 	//Too many entanglements were added
 	if len(entanglements.List[pieceId].Elements) >= 8 { //unstable quantum system collapses on itself (returns early)
 		for _, id := range entanglements.List[pieceId].Elements {
-			measure(pieces, entanglements, id)
+			measure(board, pieces, entanglements, id)
 		}
 		return nil
 	}
@@ -312,7 +373,10 @@ func updateEntanglements(board *Board, entanglements *Entanglements, pieces *Pie
 			return err
 		}
 		entanglements.List[id] = entanglements.List[pieceId]
+		board.markChanged(id)
 	}
+	board.record(Event{Type: EVENT_ENTANGLEMENT, Piece: pieceId, Square: board.squareOf(pieceId), Gate: action,
+		Elements: append([]int{}, entanglements.List[pieceId].Elements...)})
 
 	return nil
 }
@@ -404,7 +468,12 @@ func validAction(a string) bool {
 //for the turn is done
 func move(board *Board, pieces *Pieces, startSquare int, endSquare int) {
 	tempPieceId := board.getID(startSquare)
+	board.markChanged(tempPieceId)
 	pieces.List[tempPieceId].Moved = true
 	board.Positions[startSquare] = 0
 	board.Positions[endSquare] = tempPieceId
+	if board.Occupancy != nil {
+		board.Occupancy[endSquare] = board.Occupancy[startSquare]
+		board.Occupancy[startSquare] = [2]float64{0.0, 0.0}
+	}
 }
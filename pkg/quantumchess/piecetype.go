@@ -0,0 +1,272 @@
+package quantumchess
+
+import (
+	"sort"
+)
+
+// PieceType describes how a piece moves and which pieces it influences.
+// Every state in a Piece's StateSpace is resolved to a PieceType through the registry.
+type PieceType interface {
+	// Name returns the name of the piece type, as it appears in a Piece's StateSpace.
+	Name() string
+	// Moves returns the squares a piece of this type on pos can move to:
+	// empty squares and squares occupied by a piece of the other color.
+	Moves(pos int, color int, board *Board, pieces *Pieces) []int
+	// Influence returns the occupied squares a piece of this type on pos exerts its quantum action on.
+	Influence(pos int, color int, board *Board, pieces *Pieces) []int
+}
+
+var pieceTypes = make(map[string]PieceType)
+
+var orthogonal = [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+var diagonal = [][2]int{{1, 1}, {-1, 1}, {1, -1}, {-1, -1}}
+var knightJumps = [][2]int{{1, 2}, {2, 1}, {-1, 2}, {-2, 1}, {1, -2}, {2, -1}, {-1, -2}, {-2, -1}}
+var camelJumps = [][2]int{{1, 3}, {3, 1}, {-1, 3}, {-3, 1}, {1, -3}, {3, -1}, {-1, -3}, {-3, -1}}
+
+func init() {
+	RegisterPieceType(Pawn{})
+	RegisterPieceType(&Rider{TypeName: "Bishop", Directions: diagonal})
+	RegisterPieceType(&Rider{TypeName: "Rook", Directions: orthogonal})
+	RegisterPieceType(&Rider{TypeName: "Queen", Directions: append(append([][2]int{}, orthogonal...), diagonal...)})
+	RegisterPieceType(&Leaper{TypeName: "Knight", Jumps: knightJumps})
+	RegisterPieceType(&Leaper{TypeName: "King", Jumps: append(append([][2]int{}, orthogonal...), diagonal...)})
+
+	// fairy pieces
+	RegisterPieceType(&Leaper{TypeName: "Camel", Jumps: camelJumps})
+	RegisterPieceType(&Compound{TypeName: "Archbishop", Parts: []string{"Bishop", "Knight"}})
+	RegisterPieceType(&Compound{TypeName: "Chancellor", Parts: []string{"Rook", "Knight"}})
+	RegisterPieceType(&Compound{TypeName: "Amazon", Parts: []string{"Queen", "Knight"}})
+}
+
+// RegisterPieceType adds a piece type to the registry, replacing any piece type with the same name.
+func RegisterPieceType(pieceType PieceType) {
+	pieceTypes[pieceType.Name()] = pieceType
+}
+
+// GetPieceType returns the registered piece type with the given name.
+// Returns an InvalidPieceType error if no such piece type is registered.
+func GetPieceType(name string) (PieceType, error) {
+	pieceType, ok := pieceTypes[name]
+	if !ok {
+		return nil, InvalidPieceType(name)
+	}
+	return pieceType, nil
+}
+
+// PieceTypes returns the sorted names of all registered piece types.
+func PieceTypes() []string {
+	names := make([]string, 0, len(pieceTypes))
+	for name := range pieceTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PossibleMoves returns the squares the piece on square could move to in any of its activated states.
+// Returns an error if there is no piece on square, or one of its states is not a registered PieceType.
+func PossibleMoves(board *Board, pieces *Pieces, square int) ([]int, error) {
+	id := board.getID(square)
+	if id == 0 {
+		return nil, InvalidPiece(square)
+	}
+	piece := pieces.List[id]
+	if piece == nil {
+		return nil, InvalidPieceAccess(id)
+	}
+	return piece.getMoves(board, square, pieces)
+}
+
+// Rider is a piece type that slides any number of squares along its directions until it is blocked,
+// e.g. Bishop, Rook and Queen. Directions are given as {dx, dy} pairs.
+type Rider struct {
+	TypeName   string
+	Directions [][2]int
+}
+
+// Name returns the name of the rider.
+func (r *Rider) Name() string {
+	return r.TypeName
+}
+
+// Moves returns the empty squares along each direction, and the first occupied square if it is an opposing piece.
+func (r *Rider) Moves(pos int, color int, board *Board, pieces *Pieces) []int {
+	var valid []int
+	for _, d := range r.Directions {
+		for next, ok := step(pos, d[0], d[1]); ok; next, ok = step(next, d[0], d[1]) {
+			if board.getID(next) == 0 {
+				valid = append(valid, next)
+				continue
+			}
+			if isOpponent(next, color, board, pieces) {
+				valid = append(valid, next)
+			}
+			break
+		}
+	}
+	return valid
+}
+
+// Influence returns the first occupied square along each direction.
+func (r *Rider) Influence(pos int, color int, board *Board, pieces *Pieces) []int {
+	var valid []int
+	for _, d := range r.Directions {
+		for next, ok := step(pos, d[0], d[1]); ok; next, ok = step(next, d[0], d[1]) {
+			if board.getID(next) != 0 {
+				valid = append(valid, next)
+				break
+			}
+		}
+	}
+	return valid
+}
+
+// Leaper is a piece type that jumps directly to squares at fixed offsets, e.g. Knight and King.
+// Jumps are given as {dx, dy} pairs.
+type Leaper struct {
+	TypeName string
+	Jumps    [][2]int
+}
+
+// Name returns the name of the leaper.
+func (l *Leaper) Name() string {
+	return l.TypeName
+}
+
+// Moves returns the squares reached by each jump that are empty or occupied by an opposing piece.
+func (l *Leaper) Moves(pos int, color int, board *Board, pieces *Pieces) []int {
+	var valid []int
+	for _, d := range l.Jumps {
+		next, ok := step(pos, d[0], d[1])
+		if ok && (board.getID(next) == 0 || isOpponent(next, color, board, pieces)) {
+			valid = append(valid, next)
+		}
+	}
+	return valid
+}
+
+// Influence returns the occupied squares reached by each jump.
+func (l *Leaper) Influence(pos int, color int, board *Board, pieces *Pieces) []int {
+	var valid []int
+	for _, d := range l.Jumps {
+		next, ok := step(pos, d[0], d[1])
+		if ok && board.getID(next) != 0 {
+			valid = append(valid, next)
+		}
+	}
+	return valid
+}
+
+// Compound is a piece type that combines the movement of other registered piece types,
+// e.g. the Archbishop moves as a Bishop or a Knight.
+type Compound struct {
+	TypeName string
+	Parts    []string
+}
+
+// Name returns the name of the compound piece.
+func (c *Compound) Name() string {
+	return c.TypeName
+}
+
+// Moves returns the moves of every part, without duplicates.
+func (c *Compound) Moves(pos int, color int, board *Board, pieces *Pieces) []int {
+	var valid []int
+	for _, part := range c.Parts {
+		if pieceType, err := GetPieceType(part); err == nil {
+			valid = appendUnique(valid, pieceType.Moves(pos, color, board, pieces))
+		}
+	}
+	return valid
+}
+
+// Influence returns the influence of every part, without duplicates.
+func (c *Compound) Influence(pos int, color int, board *Board, pieces *Pieces) []int {
+	var valid []int
+	for _, part := range c.Parts {
+		if pieceType, err := GetPieceType(part); err == nil {
+			valid = appendUnique(valid, pieceType.Influence(pos, color, board, pieces))
+		}
+	}
+	return valid
+}
+
+// Pawn is the piece type of pawns. It moves forward towards the opponent and captures diagonally.
+type Pawn struct{}
+
+// Name returns "Pawn"
+func (p Pawn) Name() string {
+	return "Pawn"
+}
+
+// Moves returns the square in front of the pawn if it is empty, two squares forward from its starting row,
+// and the forward diagonals if they hold an opposing piece or are the en passant square.
+func (p Pawn) Moves(pos int, color int, board *Board, pieces *Pieces) []int {
+	var valid []int
+	dy := pawnDirection(color)
+	next, ok := step(pos, 0, dy)
+	if ok && board.getID(next) == 0 {
+		valid = append(valid, next)
+		startRow := 6
+		if color == BLACK {
+			startRow = 1
+		}
+		double, ok := step(next, 0, dy)
+		if getRow(pos) == startRow && ok && board.getID(double) == 0 {
+			valid = append(valid, double)
+		}
+	}
+	for _, dx := range []int{-1, 1} {
+		capture, ok := step(pos, dx, dy)
+		if ok && (isOpponent(capture, color, board, pieces) || (board.EnPassant != 0 && capture == board.EnPassant)) {
+			valid = append(valid, capture)
+		}
+	}
+	return valid
+}
+
+// Influence returns the square in front of the pawn if it is occupied.
+func (p Pawn) Influence(pos int, color int, board *Board, pieces *Pieces) []int {
+	var valid []int
+	next, ok := step(pos, 0, pawnDirection(color))
+	if ok && board.getID(next) != 0 {
+		valid = append(valid, next)
+	}
+	return valid
+}
+
+// pawnDirection returns the row direction pawns of the given color move towards.
+func pawnDirection(color int) int {
+	if color == WHITE {
+		return -1
+	}
+	return 1
+}
+
+// step moves dx columns and dy rows from pos. Returns false if the result is off the board.
+func step(pos int, dx int, dy int) (int, bool) {
+	col := pos%8 + dx
+	row := getRow(pos) + dy
+	if !inBoardRow(row) || !inBoardRow(col) {
+		return -1, false
+	}
+	return row*8 + col, true
+}
+
+// isOpponent checks whether the square holds a piece that is not of the given color.
+func isOpponent(pos int, color int, board *Board, pieces *Pieces) bool {
+	id := board.getID(pos)
+	if id == 0 || pieces == nil || pieces.List[id] == nil {
+		return false
+	}
+	return pieces.List[id].Color != color
+}
+
+func appendUnique(valid []int, squares []int) []int {
+	for _, square := range squares {
+		if !find(valid, square) {
+			valid = append(valid, square)
+		}
+	}
+	return valid
+}
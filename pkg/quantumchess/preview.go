@@ -0,0 +1,186 @@
+package quantumchess
+
+// MAX_PREVIEW_OUTCOMES is the number of measurement branches PreviewMove enumerates at most.
+var MAX_PREVIEW_OUTCOMES int = 256
+
+// Preview describes what could happen if a move was applied.
+type Preview struct {
+	Outcomes           []Outcome `json:"outcomes"`
+	CaptureProbability float64   `json:"captureProbability"`
+	// Marginals is the probability of each state of each piece after the move, by piece id.
+	// A piece that may be captured has marginals summing to less than 1.
+	Marginals map[int]map[string]float64 `json:"marginals"`
+	Truncated bool                       `json:"truncated"` // more than MAX_PREVIEW_OUTCOMES outcomes were possible
+}
+
+// Outcome is one branch of the measurements a move performs.
+type Outcome struct {
+	Probability float64 `json:"probability"`
+	Captured    []int   `json:"captured"`  // ids of the pieces captured
+	Measured    []int   `json:"measured"`  // ids of the pieces measured, in type or position
+	Entangled   []int   `json:"entangled"` // ids of the pieces whose entanglement changed without being measured
+	Positions   []int   `json:"positions"` // board after the move
+	Events      []Event `json:"events"`    // events of the move in this branch
+}
+
+// choice is a measurement performed while previewing a move.
+type choice struct {
+	probabilities []float64
+	selected      int
+}
+
+// PreviewMove applies a move to a copy of the position once for every possible result of its measurements,
+// and returns the outcomes with their probabilities. The position is left unchanged.
+// Returns an error if the move is not valid.
+func PreviewMove(board *Board, entanglements *Entanglements, pieces *Pieces, move Move) (*Preview, error) {
+	if err := checkMove(board, pieces, move); err != nil {
+		return nil, err
+	}
+	preview := &Preview{Marginals: make(map[int]map[string]float64)}
+
+	// depth first search over the measurement results: a branch is the list of results of its measurements
+	branches := [][]int{nil}
+	for len(branches) > 0 {
+		if len(preview.Outcomes) >= MAX_PREVIEW_OUTCOMES {
+			preview.Truncated = true
+			break
+		}
+		branch := branches[len(branches)-1]
+		branches = branches[:len(branches)-1]
+
+		outcome, newPieces, choices, err := previewBranch(board, entanglements, pieces, move, branch)
+		if err != nil {
+			return nil, err
+		}
+		if outcome.Probability == 0 {
+			continue
+		}
+		preview.addOutcome(outcome, newPieces)
+
+		// every measurement after the branch's prescribed results could have had another result
+		for i := len(branch); i < len(choices); i++ {
+			for result, p := range choices[i].probabilities {
+				if result == choices[i].selected || p == 0 {
+					continue
+				}
+				alternative := make([]int, i+1)
+				for j := 0; j < i; j++ {
+					alternative[j] = choices[j].selected
+				}
+				alternative[i] = result
+				branches = append(branches, alternative)
+			}
+		}
+	}
+	return preview, nil
+}
+
+// previewBranch applies a move to a copy of the position, with the first measurements giving the results of branch
+// and the following ones their first possible result.
+// Returns the outcome, the pieces after the move and every measurement performed.
+func previewBranch(board *Board, entanglements *Entanglements, pieces *Pieces, move Move,
+	branch []int) (Outcome, *Pieces, []choice, error) {
+	newBoard, newEntanglements, newPieces := board.Copy(), entanglements.Copy(), pieces.Copy()
+	var choices []choice
+	branchProbability := 1.0
+	newBoard.chooser = func(probabilities []float64) int {
+		total := 0.0
+		for _, p := range probabilities {
+			total += p
+		}
+		selected := 0
+		if len(choices) < len(branch) {
+			selected = branch[len(choices)]
+		} else {
+			for selected < len(probabilities)-1 && probabilities[selected] == 0 {
+				selected++
+			}
+		}
+		if total > 0 {
+			branchProbability *= probabilities[selected] / total
+		}
+		choices = append(choices, choice{probabilities: probabilities, selected: selected})
+		return selected
+	}
+
+	events, err := applyMove(newBoard, newEntanglements, newPieces, move)
+	if err != nil {
+		return Outcome{}, nil, nil, err
+	}
+
+	outcome := Outcome{Probability: branchProbability, Positions: newBoard.Positions, Events: events}
+	mover := board.getID(move.Start)
+	if move.Type == MERGE_MOVE {
+		mover = board.getID(move.Targets[0])
+	}
+	beforeSquares := countSquares(board)
+	afterSquares := countSquares(newBoard)
+	for id, before := range pieces.List {
+		if before == nil {
+			continue
+		}
+		after := newPieces.List[id]
+		if after == nil {
+			outcome.Captured = append(outcome.Captured, id)
+		} else if activatedStates(after) < activatedStates(before) ||
+			(afterSquares[id] < beforeSquares[id] && !merged(board, move, mover, id)) {
+			outcome.Measured = append(outcome.Measured, id)
+		} else if !sameEntanglement(entanglements.List[id], newEntanglements.List[id]) {
+			outcome.Entangled = append(outcome.Entangled, id)
+		}
+	}
+	return outcome, newPieces, choices, nil
+}
+
+// addOutcome adds an outcome to the preview, and the states of its pieces weighted by its probability to the marginals.
+func (preview *Preview) addOutcome(outcome Outcome, pieces *Pieces) {
+	preview.Outcomes = append(preview.Outcomes, outcome)
+	if len(outcome.Captured) > 0 {
+		preview.CaptureProbability += outcome.Probability
+	}
+	weight := outcome.Probability
+	for id, piece := range pieces.List {
+		if piece == nil {
+			continue
+		}
+		if preview.Marginals[id] == nil {
+			preview.Marginals[id] = make(map[string]float64)
+		}
+		total := 0.0
+		for _, state := range piece.StateSpace {
+			total += probability(piece.State[state])
+		}
+		for _, state := range piece.StateSpace {
+			if total > 0 {
+				preview.Marginals[id][state] += weight * probability(piece.State[state]) / total
+			}
+		}
+	}
+}
+
+// sameEntanglement checks whether two entanglements have the same elements and state.
+func sameEntanglement(e1 *Entanglement, e2 *Entanglement) bool {
+	if e1 == nil || e2 == nil {
+		return e1 == e2
+	}
+	if len(e1.Elements) != len(e2.Elements) || len(e1.State) != len(e2.State) {
+		return false
+	}
+	for i := range e1.Elements {
+		if e1.Elements[i] != e2.Elements[i] {
+			return false
+		}
+	}
+	for i := range e1.State {
+		if roundAmplitude(e1.State[i]) != roundAmplitude(e2.State[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// merged checks whether the piece with the given id is the moving piece merging its parts in the Split variant,
+// which reduces its squares without measuring it.
+func merged(board *Board, move Move, mover int, id int) bool {
+	return id == mover && (move.Type == MERGE_MOVE || board.getID(move.End) == id)
+}
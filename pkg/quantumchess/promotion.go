@@ -0,0 +1,81 @@
+package quantumchess
+
+import (
+	"fmt"
+	"math"
+)
+
+// validPromotion checks that a pawn can be promoted to the given piece type.
+func validPromotion(promotion string) error {
+	if promotion == "Pawn" || promotion == "King" {
+		return InvalidPromotion(promotion)
+	}
+	if _, err := GetPieceType(promotion); err != nil {
+		return InvalidPromotion(promotion)
+	}
+	return nil
+}
+
+// promote promotes the Pawn branch of the piece on square if it has reached the last rank.
+// A piece that is only partially a Pawn keeps its other states: only the Pawn branch of its StateSpace
+// becomes the promotion type. If the piece is already superposed with the promotion type, both branches
+// are the same piece and it becomes determined. Entangled pieces are measured first in that case,
+// since their state vector changes size.
+func promote(board *Board, entanglements *Entanglements, pieces *Pieces, square int, promotion string) error {
+	id := board.getID(square)
+	if id == 0 || pieces.List[id] == nil {
+		return nil
+	}
+	piece := pieces.List[id]
+	if !lastRank(square, piece.Color) {
+		return nil
+	}
+	amplitude, ok := piece.State["Pawn"]
+	if !ok || !nonZero(amplitude) {
+		return nil
+	}
+	board.markChanged(id)
+	if DEBUGAPPLYMOVE {
+		fmt.Println("Promoting the Pawn branch of piece ", id, " to ", promotion)
+	}
+
+	if _, superposed := piece.State[promotion]; !superposed {
+		for i, state := range piece.StateSpace {
+			if state == "Pawn" {
+				piece.StateSpace[i] = promotion
+			}
+		}
+		piece.State[promotion] = piece.State["Pawn"]
+		delete(piece.State, "Pawn")
+		if initial, ok := piece.InitialState["Pawn"]; ok {
+			piece.InitialState[promotion] = initial
+			delete(piece.InitialState, "Pawn")
+		}
+		return nil
+	}
+
+	// the Pawn branch joins the promotion branch
+	if entanglements.List[id] != nil {
+		measure(board, pieces, entanglements, id)
+	}
+	total := probability(piece.State["Pawn"]) + probability(piece.State[promotion])
+	var stateSpace []string
+	for _, state := range piece.StateSpace {
+		if state != "Pawn" {
+			stateSpace = append(stateSpace, state)
+		}
+	}
+	piece.StateSpace = stateSpace
+	delete(piece.State, "Pawn")
+	delete(piece.InitialState, "Pawn")
+	piece.State[promotion] = [2]float64{math.Sqrt(total), 0.0}
+	return nil
+}
+
+// lastRank checks whether square is on the rank pawns of the given color promote on.
+func lastRank(square int, color int) bool {
+	if color == WHITE {
+		return getRow(square) == 0
+	}
+	return getRow(square) == 7
+}
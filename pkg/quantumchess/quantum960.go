@@ -0,0 +1,113 @@
+package quantumchess
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// QUANTUM960 is the name of randomized setups. A generated setup is named after its seed, e.g. "quantum960-42".
+var QUANTUM960 string = "quantum960"
+
+// quantum960Partners are the types a back rank piece can be superposed with.
+var quantum960Partners = []string{"Pawn", "Knight", "Bishop", "Rook"}
+
+// GenerateQuantum960 builds a Classic setup with a shuffled back rank, in the manner of Chess960:
+// bishops on opposite colored squares and the king between the rooks.
+// The partner type and the gate of every piece are randomized too. The same seed always builds the same setup,
+// and both colors get mirrored positions.
+func GenerateQuantum960(seed int64) *SetupDefinition {
+	r := rand.New(rand.NewSource(seed))
+	backRank := shuffleBackRank(r)
+
+	partners := make([]string, 8)
+	actions := make([]string, 8)
+	for col, pieceType := range backRank {
+		if pieceType == "King" {
+			continue
+		}
+		partner := pieceType
+		for partner == pieceType {
+			partner = quantum960Partners[r.Intn(len(quantum960Partners))]
+		}
+		partners[col] = partner
+		actions[col] = ACTIONS[1+r.Intn(len(ACTIONS)-1)] // every action but None
+	}
+	pawnActions := make([]string, 8)
+	for col := range pawnActions {
+		pawnActions[col] = ACTIONS[1+r.Intn(len(ACTIONS)-1)]
+	}
+
+	definition := &SetupDefinition{Name: fmt.Sprintf("%v-%d", QUANTUM960, seed), Variant: "Classic"}
+	superposed := [][2]float64{{1 / math.Sqrt(2), 0.0}, {1 / math.Sqrt(2), 0.0}}
+	determined := [][2]float64{{1.0, 0.0}, {0.0, 0.0}}
+	files := "abcdefgh"
+
+	// same id layout as the standard setup: black back rank, black pawns, white pawns, white back rank
+	for _, rank := range []struct {
+		number int
+		color  string
+		pawns  bool
+	}{{8, "black", false}, {7, "black", true}, {2, "white", true}, {1, "white", false}} {
+		for col, pieceType := range backRank {
+			p := PieceDefinition{Square: fmt.Sprintf("%c%d", files[col], rank.number), Color: rank.color}
+			if rank.pawns {
+				p.StateSpace = []string{"Pawn", pieceType}
+				p.Amplitudes = determined
+				p.Action = pawnActions[col]
+			} else if pieceType == "King" {
+				p.StateSpace = []string{"King"}
+				p.Action = "None"
+			} else {
+				p.StateSpace = []string{pieceType, partners[col]}
+				p.Amplitudes = superposed
+				p.Action = actions[col]
+			}
+			definition.Pieces = append(definition.Pieces, p)
+		}
+	}
+	return definition
+}
+
+// shuffleBackRank places the bishops on opposite colors, then the queen and knights on random free squares,
+// and finally the rooks and king on the three remaining squares, in that order.
+func shuffleBackRank(r *rand.Rand) [8]string {
+	var backRank [8]string
+	backRank[2*r.Intn(4)] = "Bishop"
+	backRank[2*r.Intn(4)+1] = "Bishop"
+
+	for _, pieceType := range []string{"Queen", "Knight", "Knight"} {
+		free := freeColumns(backRank)
+		backRank[free[r.Intn(len(free))]] = pieceType
+	}
+
+	for i, col := range freeColumns(backRank) {
+		backRank[col] = [3]string{"Rook", "King", "Rook"}[i]
+	}
+	return backRank
+}
+
+func freeColumns(backRank [8]string) []int {
+	var free []int
+	for col, pieceType := range backRank {
+		if pieceType == "" {
+			free = append(free, col)
+		}
+	}
+	return free
+}
+
+// ParseQuantum960 returns the seed of a generated setup name, e.g. 42 for "quantum960-42".
+// Returns false if the name is not the name of a generated setup.
+func ParseQuantum960(name string) (int64, bool) {
+	if !strings.HasPrefix(name, QUANTUM960+"-") {
+		return 0, false
+	}
+	seed, err := strconv.ParseInt(strings.TrimPrefix(name, QUANTUM960+"-"), 10, 64)
+	if err != nil || seed < 0 {
+		return 0, false
+	}
+	return seed, true
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"strings"
 	"testing"
 )
 
@@ -21,7 +22,7 @@ func TestApplyMove(t *testing.T) {
 	}
 
 
-	err:= ApplyMove(board, entanglements, pieces, 62, 45)
+	_, err := ApplyMove(board, entanglements, pieces, 62, 45)
 	if err != nil{
 		t.Logf("All tests passed lol")
 	}
@@ -257,6 +258,32 @@ func testAoF(t *testing.T, piece *Piece, pos int, board *Board, expected map[int
 	}
 }
 
+//TestImaginaryStates tests that a state counts toward the area of influence when its amplitude is non zero,
+//even if it is purely imaginary, and does not count when it is zero.
+func TestImaginaryStates(t *testing.T) {
+	positions := [64]int{
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 2, 0, 0,
+		0, 0, 0, 0, 5, 0, 0, 0,
+		0, 0, 0, 3, 0, 4, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	}
+	board := &Board{}
+	createBoard(t, board, positions[:])
+
+	// the rook state has no amplitude, the bishop state is purely imaginary
+	piece := &Piece{}
+	state := map[string][2]float64{"Rook": {0.0, 0.0}, "Bishop": {0.0, 1 / math.Sqrt(2)}}
+	createPiece(t, piece, "Hadamard", 1, state, []string{"Rook", "Bishop"}, state, false)
+	if nonZero(state["Rook"]) || !nonZero(state["Bishop"]) {
+		t.Errorf("Expected only the bishop state to be non zero")
+	}
+	testAoF(t, piece, 20, board, map[int]bool{13: true, 27: true, 29: true}, &Pieces{})
+}
+
 func testBishopAof(t *testing.T, pieces *Pieces) {
 	positions := [64]int{
 		0, 0, 0, 0, 0, 0, 0, 0,
@@ -716,3 +743,813 @@ func testKingAoF(t *testing.T, pieces *Pieces) {
 	}
 	testAoF(t, qKing, 0, board2, res2, pieces)
 }
+
+//TestSplitVariant tests splitting, merging and measuring pieces in the Split variant.
+func TestSplitVariant(t *testing.T) {
+	DEBUGAPPLYMOVE = false
+	board := &Board{}
+	entanglements := &Entanglements{}
+	pieces := &Pieces{}
+
+	err := SetupVariant("Split", board, entanglements, pieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if SetupVariant("Unknown", &Board{}, &Entanglements{}, &Pieces{}) == nil {
+		t.Errorf("Expected an error for an unknown variant")
+	}
+
+	// white knight on g1 splits onto f3 and h3
+	_, err = ApplySplitMove(board, entanglements, pieces, 62, 45, 47)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBoardGetID(t, board, 62, 0)
+	testBoardGetID(t, board, 45, 31)
+	testBoardGetID(t, board, 47, 31)
+	for _, square := range []int{45, 47} {
+		if !approxEqualFloat(probability(board.Occupancy[square]), 0.5) {
+			t.Errorf("Expected occupancy of %d to be 0.5, got %v", square, probability(board.Occupancy[square]))
+		}
+	}
+
+	if _, err := ApplySplitMove(board, entanglements, pieces, 45, 47, 30); err == nil {
+		t.Errorf("Expected an error when splitting onto an occupied square")
+	}
+
+	_, err = ApplyMergeMove(board, entanglements, pieces, 45, 47, 45)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBoardGetID(t, board, 47, 0)
+	testBoardGetID(t, board, 45, 31)
+	if !approxEqualFloat(probability(board.Occupancy[45]), 1.0) {
+		t.Errorf("Expected merged occupancy to be 1, got %v", probability(board.Occupancy[45]))
+	}
+
+	// a split black knight is captured: it is measured first and only captured if it was there
+	_, err = ApplySplitMove(board, entanglements, pieces, 1, 16, 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	board.Positions[27] = 28 // place the white queen where it can reach the knight
+	board.Positions[59] = 0
+	board.Occupancy[27] = [2]float64{1.0, 0.0}
+	board.Occupancy[59] = [2]float64{0.0, 0.0}
+	_, err = ApplyMove(board, entanglements, pieces, 27, 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBoardGetID(t, board, 18, 28)
+	testBoardGetID(t, board, 27, 0)
+	if pieces.List[2] != nil {
+		testBoardGetID(t, board, 16, 2)
+		if !approxEqualFloat(probability(board.Occupancy[16]), 1.0) {
+			t.Errorf("Expected knight to be measured on 16")
+		}
+	} else {
+		testBoardGetID(t, board, 16, 0)
+	}
+}
+
+//TestSplitBlockedUnchanged tests that a split rejected because of a blocked path leaves the board unchanged.
+func TestSplitBlockedUnchanged(t *testing.T) {
+	DEBUGAPPLYMOVE = false
+	board := &Board{}
+	entanglements := &Entanglements{}
+	pieces := &Pieces{}
+	if err := SetupVariant("Split", board, entanglements, pieces); err != nil {
+		t.Fatal(err)
+	}
+	// the d2 pawn is split between d2 and d4, the e2 pawn is certainly on e2
+	pawn := board.getID(51)
+	half := [2]float64{1 / math.Sqrt(2), 0.0}
+	board.Positions[35] = pawn
+	board.Occupancy[35] = half
+	board.Occupancy[51] = half
+	positions := append([]int(nil), board.Positions...)
+	occupancy := append([][2]float64(nil), board.Occupancy...)
+
+	// the white queen on d1 splits onto d3, behind the uncertain pawn, and f3, behind the certain one
+	if _, err := ApplySplitMove(board, entanglements, pieces, 59, 43, 45); err == nil {
+		t.Fatal("Expected an error when splitting through a piece in a determined position")
+	}
+	for square := range positions {
+		if positions[square] != board.Positions[square] || occupancy[square] != board.Occupancy[square] {
+			t.Errorf("Expected square %d to be unchanged after a failed split", square)
+		}
+	}
+}
+
+func TestPathBetween(t *testing.T) {
+	tests := []struct {
+		start, end int
+		expected   []int
+	}{
+		{56, 0, []int{48, 40, 32, 24, 16, 8}},
+		{0, 3, []int{1, 2}},
+		{63, 27, []int{54, 45, 36}},
+		{62, 45, nil},
+		{3, 4, nil},
+	}
+	for _, test := range tests {
+		path := pathBetween(test.start, test.end)
+		if len(path) != len(test.expected) {
+			t.Errorf("Expected path from %d to %d to be %v, got %v", test.start, test.end, test.expected, path)
+			continue
+		}
+		for i := range path {
+			if path[i] != test.expected[i] {
+				t.Errorf("Expected path from %d to %d to be %v, got %v", test.start, test.end, test.expected, path)
+			}
+		}
+	}
+}
+
+//TestPieceTypes tests the piece type registry and the movement of fairy pieces.
+func TestPieceTypes(t *testing.T) {
+	board := &Board{Positions: make([]int, 64, 64)}
+	pieces := &Pieces{List: map[int]*Piece{
+		1: __createPiece("Archbishop", WHITE),
+		2: __createPiece("Pawn", BLACK),
+		3: __createPiece("Pawn", WHITE),
+	}}
+	board.Positions[35] = 1 // d4
+	board.Positions[17] = 2 // b6, reachable diagonally and capturable
+	board.Positions[29] = 3 // f5, a knight jump onto a friendly piece
+
+	moves, err := PossibleMoves(board, pieces, 35)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 13 - 1 bishop squares (blocked after b6) + 8 - 1 knight squares (f5 is friendly)
+	if len(moves) != 19 {
+		t.Errorf("Expected Archbishop to have 19 moves, got %d: %v", len(moves), moves)
+	}
+	if !find(moves, 17) || find(moves, 8) || find(moves, 29) {
+		t.Errorf("Archbishop moves are incorrect: %v", moves)
+	}
+
+	camel, err := GetPieceType("Camel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	camelMoves := camel.Moves(56, WHITE, &Board{Positions: make([]int, 64, 64)}, pieces)
+	if len(camelMoves) != 2 || !find(camelMoves, 33) || !find(camelMoves, 51) {
+		t.Errorf("Expected Camel on a1 to reach 33 and 51, got %v", camelMoves)
+	}
+
+	pieces.List[1] = __createPiece("Grasshopper", WHITE)
+	if _, err := PossibleMoves(board, pieces, 35); err == nil {
+		t.Errorf("Expected an error for an unregistered piece type")
+	}
+}
+
+//TestSetups tests loading, validating and applying setup definitions.
+func TestSetups(t *testing.T) {
+	board := &Board{}
+	entanglements := &Entanglements{}
+	pieces := &Pieces{}
+	if err := SetupInitialQuantumChess(board, entanglements, pieces); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pieces.List) != 32 {
+		t.Errorf("Expected 32 pieces in the standard setup, got %d", len(pieces.List))
+	}
+	testBoardGetID(t, board, 3, 4)
+	testBoardGetID(t, board, 60, 29)
+	if pieces.List[4].StateSpace[0] != "King" || pieces.List[29].StateSpace[0] != "King" {
+		t.Errorf("Expected kings to have ids 4 and 29")
+	}
+	if pieces.List[25].Action != "Measurement" || pieces.List[20].StateSpace[1] != "Queen" {
+		t.Errorf("Unexpected pieces in the standard setup: %v, %v", pieces.List[25], pieces.List[20])
+	}
+	if !approxEqual(pieces.List[1].State["Rook"], [2]float64{1 / math.Sqrt(2), 0.0}) {
+		t.Errorf("Expected rooks to start in an equal superposition, got %v", pieces.List[1].State)
+	}
+
+	invalid := []string{
+		`{"pieces": [{"square": "e1", "color": "white", "stateSpace": ["King"]}]}`,
+		`{"name": "a", "pieces": [{"square": "e9", "color": "white", "stateSpace": ["King"]}]}`,
+		`{"name": "a", "pieces": [{"square": "e1", "color": "red", "stateSpace": ["King"]}]}`,
+		`{"name": "a", "pieces": [{"square": "e1", "color": "white", "stateSpace": ["Dragon"]}]}`,
+		`{"name": "a", "pieces": [{"square": "e1", "color": "white", "stateSpace": ["King"], "amplitudes": [[0.5, 0]]}]}`,
+		`{"name": "a", "pieces": [{"square": "e1", "color": "white", "stateSpace": ["King"]},
+			{"square": "e1", "color": "black", "stateSpace": ["King"]}]}`,
+	}
+	for _, document := range invalid {
+		if _, err := LoadSetup(strings.NewReader(document)); err == nil {
+			t.Errorf("Expected setup to be invalid: %v", document)
+		}
+	}
+
+	if err := LoadSetupsFromDir("../../setups"); err != nil {
+		t.Fatal(err)
+	}
+	fairy, err := GetSetup("fairy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplySetup(fairy, board, entanglements, pieces); err != nil {
+		t.Fatal(err)
+	}
+	if pieces.List[4].StateSpace[1] != "Amazon" {
+		t.Errorf("Expected the fairy queen to be superposed with an Amazon, got %v", pieces.List[4].StateSpace)
+	}
+
+	// a missing setup is an error, not a panic
+	split := setups["split"]
+	delete(setups, "split")
+	err = SetupSplitQuantumChess(&Board{}, &Entanglements{}, &Pieces{})
+	RegisterSetup(split)
+	if _, ok := err.(InvalidSetup); !ok {
+		t.Errorf("Expected an InvalidSetup error without a split setup, got %v", err)
+	}
+}
+
+//TestQuantum960 tests that generated setups follow the Chess960 constraints and are reproducible.
+func TestQuantum960(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		definition := GenerateQuantum960(seed)
+		if err := definition.Validate(); err != nil {
+			t.Fatalf("Seed %d generated an invalid setup: %v", seed, err)
+		}
+		var bishops, rooks []int
+		king := -1
+		for col, p := range definition.Pieces[24:] { // white back rank
+			if p.StateSpace[0] == "Bishop" {
+				bishops = append(bishops, col)
+			} else if p.StateSpace[0] == "Rook" {
+				rooks = append(rooks, col)
+			} else if p.StateSpace[0] == "King" {
+				king = col
+			}
+			black := definition.Pieces[col]
+			if black.StateSpace[0] != p.StateSpace[0] || black.Action != p.Action {
+				t.Errorf("Seed %d: black and white positions are not mirrored on column %d", seed, col)
+			}
+		}
+		if len(bishops) != 2 || bishops[0]%2 == bishops[1]%2 {
+			t.Errorf("Seed %d: bishops are not on opposite colors: %v", seed, bishops)
+		}
+		if len(rooks) != 2 || king < rooks[0] || king > rooks[1] {
+			t.Errorf("Seed %d: king %d is not between rooks %v", seed, king, rooks)
+		}
+	}
+
+	first, err := GetSetup("quantum960-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := GenerateQuantum960(42)
+	for i := range first.Pieces {
+		if first.Pieces[i].Square != second.Pieces[i].Square || first.Pieces[i].Action != second.Pieces[i].Action ||
+			first.Pieces[i].StateSpace[1%len(first.Pieces[i].StateSpace)] !=
+				second.Pieces[i].StateSpace[1%len(second.Pieces[i].StateSpace)] {
+			t.Errorf("Expected setup 42 to be reproducible, piece %d differs", i)
+		}
+	}
+	if _, ok := ParseQuantum960("quantum960-abc"); ok {
+		t.Errorf("Expected quantum960-abc not to be a generated setup name")
+	}
+}
+
+//TestPromotion tests promoting determined and superposed pawns on the last rank.
+func TestPromotion(t *testing.T) {
+	DEBUGAPPLYMOVE = false
+	board := &Board{Positions: make([]int, 64, 64)}
+	entanglements := &Entanglements{List: make(map[int]*Entanglement)}
+	pieces := &Pieces{List: map[int]*Piece{
+		1: __createPiece("Pawn", WHITE),
+		2: {Action: "None", Color: WHITE, StateSpace: []string{"Pawn", "Rook"},
+			InitialState: map[string][2]float64{"Pawn": {1.0, 0.0}, "Rook": {0.0, 0.0}},
+			State:        map[string][2]float64{"Pawn": {1 / math.Sqrt(2), 0.0}, "Rook": {1 / math.Sqrt(2), 0.0}}},
+		3: {Action: "None", Color: BLACK, StateSpace: []string{"Pawn", "Queen"},
+			InitialState: map[string][2]float64{"Pawn": {1.0, 0.0}, "Queen": {0.0, 0.0}},
+			State:        map[string][2]float64{"Pawn": {1 / math.Sqrt(2), 0.0}, "Queen": {1 / math.Sqrt(2), 0.0}}},
+	}}
+	board.Positions[8] = 1
+	board.Positions[10] = 2
+	board.Positions[52] = 3
+
+	if _, err := ApplyPromotionMove(board, entanglements, pieces, 8, 0, "King"); err == nil {
+		t.Errorf("Expected promoting to a King to fail")
+	}
+	if _, err := ApplyMove(board, entanglements, pieces, 8, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(pieces.List[1].StateSpace) != 1 || pieces.List[1].StateSpace[0] != "Queen" {
+		t.Errorf("Expected pawn to be promoted to a Queen, got %v", pieces.List[1].StateSpace)
+	}
+
+	// only the Pawn branch of a Pawn/Rook piece is promoted
+	if _, err := ApplyPromotionMove(board, entanglements, pieces, 10, 2, "Knight"); err != nil {
+		t.Fatal(err)
+	}
+	piece := pieces.List[2]
+	if piece.StateSpace[0] != "Knight" || piece.StateSpace[1] != "Rook" {
+		t.Errorf("Expected state space [Knight Rook], got %v", piece.StateSpace)
+	}
+	if !approxEqual(piece.State["Knight"], [2]float64{1 / math.Sqrt(2), 0.0}) || piece.InitialState["Knight"][0] != 1.0 {
+		t.Errorf("Expected the Knight branch to keep the Pawn amplitudes, got %v", piece.State)
+	}
+
+	// a Pawn/Queen piece promoting to a Queen is a Queen in both branches
+	if _, err := ApplyMove(board, entanglements, pieces, 52, 60); err != nil {
+		t.Fatal(err)
+	}
+	piece = pieces.List[3]
+	if len(piece.StateSpace) != 1 || !approxEqual(piece.State["Queen"], [2]float64{1.0, 0.0}) {
+		t.Errorf("Expected a determined Queen, got %v %v", piece.StateSpace, piece.State)
+	}
+}
+
+//TestCastling tests castling with a determined rook and with a superposed rook.
+func TestCastling(t *testing.T) {
+	DEBUGAPPLYMOVE = false
+	for i := 0; i < 20; i++ {
+		board := &Board{Positions: make([]int, 64, 64)}
+		entanglements := &Entanglements{List: make(map[int]*Entanglement)}
+		rook := __createPiece("Rook", WHITE)
+		superposedRook := &Piece{Action: "Measurement", Color: WHITE, StateSpace: []string{"Rook", "Pawn"},
+			InitialState: map[string][2]float64{"Rook": {1 / math.Sqrt(2), 0.0}, "Pawn": {1 / math.Sqrt(2), 0.0}},
+			State:        map[string][2]float64{"Rook": {1 / math.Sqrt(2), 0.0}, "Pawn": {1 / math.Sqrt(2), 0.0}}}
+		pieces := &Pieces{List: map[int]*Piece{1: __createPiece("King", WHITE), 2: rook, 3: superposedRook}}
+		board.Positions[60] = 1
+		board.Positions[63] = 2
+		board.Positions[56] = 3
+
+		if _, err := ApplyMove(board, entanglements, pieces, 60, 62); err != nil {
+			t.Fatal(err)
+		}
+		testBoardGetID(t, board, 62, 1)
+		testBoardGetID(t, board, 61, 2)
+		board.Positions[62], board.Positions[60] = 0, 1
+		if _, err := ApplyMove(board, entanglements, pieces, 60, 58); err == nil {
+			t.Errorf("Expected castling after the king moved to fail")
+		}
+
+		pieces.List[1].Moved = false
+		if _, err := ApplyMove(board, entanglements, pieces, 60, 58); err != nil {
+			t.Fatal(err)
+		}
+		if determinedAs(superposedRook, "Rook") {
+			testBoardGetID(t, board, 58, 1)
+			testBoardGetID(t, board, 59, 3)
+		} else if !determinedAs(superposedRook, "Pawn") {
+			t.Errorf("Expected the rook to be measured, got %v", superposedRook.State)
+		} else {
+			testBoardGetID(t, board, 60, 1)
+			testBoardGetID(t, board, 56, 3)
+		}
+	}
+}
+
+//TestCastlingAttacked tests that the king cannot castle out of, through or into a square it may be attacked on.
+func TestCastlingAttacked(t *testing.T) {
+	DEBUGAPPLYMOVE = false
+	superposedRook := func() *Piece {
+		return &Piece{Action: "None", Color: BLACK, StateSpace: []string{"Rook", "Pawn"},
+			InitialState: map[string][2]float64{"Rook": {1 / math.Sqrt(2), 0.0}, "Pawn": {1 / math.Sqrt(2), 0.0}},
+			State:        map[string][2]float64{"Rook": {1 / math.Sqrt(2), 0.0}, "Pawn": {1 / math.Sqrt(2), 0.0}}}
+	}
+	for _, test := range []struct {
+		name     string
+		attacker *Piece
+		square   int // square of the black attacker
+		castles  bool
+	}{
+		{"no attack", __createPiece("Rook", BLACK), 7, true},                      // h8 attacks the rook only
+		{"in check", __createPiece("Rook", BLACK), 4, false},                      // e8
+		{"passing an attacked square", __createPiece("Rook", BLACK), 5, false},    // f8
+		{"landing on an attacked square", __createPiece("Rook", BLACK), 6, false}, // g8
+		{"maybe attacked", superposedRook(), 5, false},
+	} {
+		board := &Board{Positions: make([]int, 64, 64)}
+		entanglements := &Entanglements{List: make(map[int]*Entanglement)}
+		pieces := &Pieces{List: map[int]*Piece{1: __createPiece("King", WHITE), 2: __createPiece("Rook", WHITE),
+			3: test.attacker}}
+		board.Positions[60] = 1
+		board.Positions[63] = 2
+		board.Positions[test.square] = 3
+
+		_, err := ApplyMove(board, entanglements, pieces, 60, 62)
+		if test.castles && err != nil {
+			t.Errorf("%v: expected castling, got %v", test.name, err)
+		}
+		if !test.castles {
+			if err == nil {
+				t.Errorf("%v: expected castling to fail", test.name)
+			}
+			testBoardGetID(t, board, 60, 1)
+			testBoardGetID(t, board, 63, 2)
+		}
+	}
+}
+
+//TestEnPassant tests en passant captures after a double pawn push.
+func TestEnPassant(t *testing.T) {
+	DEBUGAPPLYMOVE = false
+	board := &Board{Positions: make([]int, 64, 64)}
+	entanglements := &Entanglements{List: make(map[int]*Entanglement)}
+	pieces := &Pieces{List: map[int]*Piece{1: __createPiece("Pawn", WHITE), 2: __createPiece("Pawn", BLACK)}}
+	board.Positions[28] = 1 // e5
+	board.Positions[11] = 2 // d7
+
+	if _, err := ApplyMove(board, entanglements, pieces, 11, 27); err != nil {
+		t.Fatal(err)
+	}
+	if board.EnPassant != 19 {
+		t.Errorf("Expected en passant square to be 19, got %d", board.EnPassant)
+	}
+	moves, err := PossibleMoves(board, pieces, 28)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !find(moves, 19) {
+		t.Errorf("Expected en passant capture in pawn moves %v", moves)
+	}
+	if _, err := ApplyMove(board, entanglements, pieces, 28, 19); err != nil {
+		t.Fatal(err)
+	}
+	testBoardGetID(t, board, 19, 1)
+	testBoardGetID(t, board, 27, 0)
+	if pieces.List[2] != nil {
+		t.Errorf("Expected the black pawn to be captured")
+	}
+	if board.EnPassant != 0 {
+		t.Errorf("Expected en passant square to be reset, got %d", board.EnPassant)
+	}
+}
+
+//TestEnPassantNotAPawn tests that a pawn does not move diagonally onto the en passant square when the piece
+// that moved two squares is measured as another type.
+func TestEnPassantNotAPawn(t *testing.T) {
+	DEBUGAPPLYMOVE = false
+	for i := 0; i < 20; i++ {
+		board := &Board{Positions: make([]int, 64, 64)}
+		entanglements := &Entanglements{List: make(map[int]*Entanglement)}
+		superposed := &Piece{Action: "None", Color: BLACK, StateSpace: []string{"Pawn", "Knight"},
+			InitialState: map[string][2]float64{"Pawn": {1 / math.Sqrt(2), 0.0}, "Knight": {1 / math.Sqrt(2), 0.0}},
+			State:        map[string][2]float64{"Pawn": {1 / math.Sqrt(2), 0.0}, "Knight": {1 / math.Sqrt(2), 0.0}}}
+		pieces := &Pieces{List: map[int]*Piece{1: __createPiece("Pawn", WHITE), 2: superposed}}
+		board.Positions[28] = 1 // e5
+		board.Positions[27] = 2 // d5, after a double push
+		board.EnPassant = 19    // d6
+
+		if _, err := ApplyMove(board, entanglements, pieces, 28, 19); err != nil {
+			t.Fatal(err)
+		}
+		if determinedAs(superposed, "Pawn") {
+			testBoardGetID(t, board, 19, 1)
+			testBoardGetID(t, board, 27, 0)
+		} else if !determinedAs(superposed, "Knight") {
+			t.Errorf("Expected the captured piece to be measured, got %v", superposed.State)
+		} else {
+			testBoardGetID(t, board, 28, 1)
+			testBoardGetID(t, board, 19, 0)
+			testBoardGetID(t, board, 27, 2)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	board := &Board{Positions: make([]int, 64, 64)}
+	pieces := &Pieces{List: map[int]*Piece{1: __createPiece("King", BLACK), 2: __createPiece("Rook", WHITE),
+		3: __createPiece("Pawn", BLACK), 4: __createPiece("Pawn", BLACK)}}
+	board.Positions[7] = 1  // h8
+	board.Positions[0] = 2  // a8
+	board.Positions[14] = 3 // g7
+	board.Positions[15] = 4 // h7
+
+	pieces.List[2].StateSpace = []string{"Rook", "Bishop"}
+	pieces.List[2].State = map[string][2]float64{"Rook": {1 / math.Sqrt(2), 0.0}, "Bishop": {1 / math.Sqrt(2), 0.0}}
+	if p := CheckProbability(board, pieces, BLACK); math.Abs(p-0.5) > 1e-9 {
+		t.Errorf("Expected check probability 0.5, got %v", p)
+	}
+	if p := CheckProbability(board, pieces, WHITE); p != 0 {
+		t.Errorf("Expected no check without a white king, got %v", p)
+	}
+	if IsCertainCheckmate(board, pieces, BLACK) {
+		t.Errorf("Expected no certain checkmate with a superposed attacker")
+	}
+
+	pieces.List[2] = __createPiece("Rook", WHITE)
+	if !IsCertainCheckmate(board, pieces, BLACK) {
+		t.Errorf("Expected back rank checkmate")
+	}
+
+	pieces.List[5] = __createPiece("Bishop", BLACK)
+	board.Positions[36] = 5 // e4 can capture the rook
+	if IsCertainCheckmate(board, pieces, BLACK) {
+		t.Errorf("Expected no checkmate when the attacker can be captured, legal moves %v", LegalMoves(board, pieces, BLACK))
+	}
+}
+
+func TestDraws(t *testing.T) {
+	board := &Board{Positions: make([]int, 64, 64)}
+	entanglements := &Entanglements{List: make(map[int]*Entanglement)}
+	pieces := &Pieces{List: map[int]*Piece{1: __createPiece("King", BLACK), 2: __createPiece("Queen", WHITE),
+		3: __createPiece("King", WHITE)}}
+	board.Positions[0] = 1  // a8
+	board.Positions[17] = 2 // b6
+	board.Positions[63] = 3 // h1
+	if !IsStalemate(board, pieces, BLACK) {
+		t.Errorf("Expected stalemate, legal moves %v", LegalMoves(board, pieces, BLACK))
+	}
+	if IsStalemate(board, pieces, WHITE) {
+		t.Errorf("Expected white to have legal moves")
+	}
+
+	renumbered := &Pieces{List: map[int]*Piece{7: __createPiece("King", BLACK), 8: __createPiece("Queen", WHITE),
+		9: __createPiece("King", WHITE)}}
+	other := &Board{Positions: make([]int, 64, 64)}
+	other.Positions[0], other.Positions[17], other.Positions[63] = 7, 8, 9
+	board.InitHash(entanglements, pieces, BLACK)
+	other.InitHash(entanglements, renumbered, BLACK)
+	if board.Hash != other.Hash {
+		t.Errorf("Expected the hash not to depend on piece ids")
+	}
+	hash := board.Hash
+	if board.InitHash(entanglements, pieces, WHITE); board.Hash == hash {
+		t.Errorf("Expected the hash to depend on the color to move")
+	}
+
+	draws := NewDrawState(hash)
+	if reason := draws.Record(hash, false); reason != "" {
+		t.Errorf("Expected no draw after two repetitions, got %v", reason)
+	}
+	if reason := draws.Record(hash, false); reason != REASON_REPETITION {
+		t.Errorf("Expected a draw by repetition, got %v", reason)
+	}
+	draws.Undo()
+	if draws.Repetitions[hash] != 2 || draws.HalfmoveClock != 1 {
+		t.Errorf("Expected undo to remove the last repetition, got %d repetitions", draws.Repetitions[hash])
+	}
+
+	draws = NewDrawState(hash)
+	for i := 1; i < MOVE_LIMIT; i++ {
+		draws.Record(uint64(i), false)
+	}
+	if reason := draws.Record(hash, true); reason != "" {
+		t.Errorf("Expected an irreversible move to reset the move limit, got %v", reason)
+	}
+
+	after, afterPieces := simulateMove(board, pieces, 17, 0) // queen captures the king
+	if !Irreversible(board, pieces, after, afterPieces, 17) {
+		t.Errorf("Expected a capture to be irreversible")
+	}
+	after, afterPieces = simulateMove(board, pieces, 17, 18)
+	if Irreversible(board, pieces, after, afterPieces, 17) {
+		t.Errorf("Expected a quiet queen move to be reversible")
+	}
+}
+
+func TestHash(t *testing.T) {
+	DEBUGAPPLYMOVE = false
+	board := &Board{}
+	entanglements := &Entanglements{}
+	pieces := &Pieces{}
+	if err := SetupInitialQuantumChess(board, entanglements, pieces); err != nil {
+		t.Fatal(err)
+	}
+	initial := board.Hash
+
+	testHash := func(toMove int) {
+		t.Helper()
+		fresh := board.Copy()
+		fresh.InitHash(entanglements, pieces, toMove)
+		if fresh.Hash != board.Hash {
+			t.Errorf("Expected incremental hash %x to equal the hash computed from scratch %x", board.Hash, fresh.Hash)
+		}
+	}
+
+	for _, m := range [][2]int{{62, 45}, {1, 18}, {45, 62}, {18, 1}} { // knights go out and come back
+		if _, err := ApplyMove(board, entanglements, pieces, m[0], m[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testHash(WHITE)
+	if _, err := ApplyMove(board, entanglements, pieces, 52, 36); err != nil { // e4
+		t.Fatal(err)
+	}
+	testHash(BLACK)
+	withEnPassant := board.Copy()
+	withEnPassant.EnPassant = 44 // e3
+	withEnPassant.updateHash(entanglements, pieces, false)
+	if withEnPassant.Hash == board.Hash {
+		t.Errorf("Expected the en passant square to be part of the hash")
+	}
+	fresh := withEnPassant.Copy()
+	fresh.InitHash(entanglements, pieces, BLACK)
+	if fresh.Hash != withEnPassant.Hash {
+		t.Errorf("Expected the incremental hash of the en passant square to equal the hash computed from scratch")
+	}
+	if _, err := ApplyMove(board, entanglements, pieces, 11, 27); err != nil { // d5
+		t.Fatal(err)
+	}
+	if _, err := ApplyMove(board, entanglements, pieces, 36, 27); err != nil { // exd5
+		t.Fatal(err)
+	}
+	testHash(BLACK)
+	if board.Hash == initial {
+		t.Errorf("Expected the hash to change")
+	}
+
+	other := &Board{}
+	if err := SetupInitialQuantumChess(other, &Entanglements{}, &Pieces{}); err != nil {
+		t.Fatal(err)
+	}
+	if other.Hash != initial {
+		t.Errorf("Expected the same setup to have the same hash")
+	}
+}
+
+func TestGame(t *testing.T) {
+	DEBUGAPPLYMOVE = false
+	game, err := NewGame("standard", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initial := game.Board.Hash
+
+	if _, err := game.Apply(Move{Start: 11, End: 27}); err == nil {
+		t.Errorf("Expected black not to move first")
+	}
+	if _, err := game.Apply(Move{Start: 52, End: 53}); err == nil {
+		t.Errorf("Expected moving onto a piece of the same color to fail")
+	}
+	invalid := []Move{
+		{Start: 52, End: 100}, // off the board
+		{Start: 52, End: -1},  // off the board
+		{Type: SPLIT_MOVE, Start: 62, Targets: [2]int{45, 64}}, // split off the board
+		{Type: MERGE_MOVE, Targets: [2]int{52, 52}, End: 100},  // merge off the board
+		{Start: 52, End: 28}, // e2 to e5 is not a move of a pawn
+		{Start: 62, End: 46}, // g1 to g3 is not a move of a knight
+		{Type: SPLIT_MOVE, Start: 62, Targets: [2]int{45, 46}}, // nor is a split onto g3
+		{Start: 56, End: 40}, // the a1 rook is blocked by its pawn
+	}
+	for _, move := range invalid {
+		if _, err := game.Apply(move); err == nil {
+			t.Errorf("Expected %+v to be rejected", move)
+		}
+	}
+	if game.Board.Hash != initial || game.ToMove != WHITE || len(game.History) != 0 {
+		t.Errorf("Expected a failed move to leave the game unchanged")
+	}
+
+	moves := []Move{{Start: 52, End: 36}, {Start: 11, End: 27}, {Start: 36, End: 27}}
+	clone := game.Clone()
+	for _, move := range moves {
+		if _, err := game.Apply(move); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := clone.Apply(move); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if game.Board.Hash != clone.Board.Hash {
+		t.Errorf("Expected a clone to draw the same measurements")
+	}
+	if len(game.History) != 3 || game.ToMove != BLACK {
+		t.Errorf("Expected 3 moves with black to move, got %d moves and %d to move", len(game.History), game.ToMove)
+	}
+	last := game.History[2]
+	if len(last.Captured) != 1 || last.Color != WHITE || !last.Irreversible {
+		t.Errorf("Expected exd5 to be an irreversible capture by white, got %+v", last)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := game.Undo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if game.Board.Hash != initial || game.ToMove != WHITE {
+		t.Errorf("Expected undo to restore the initial position")
+	}
+	if err := game.Undo(); err == nil {
+		t.Errorf("Expected undo to fail without moves")
+	}
+	for _, move := range moves {
+		if _, err := game.Apply(move); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if game.Board.Hash != clone.Board.Hash {
+		t.Errorf("Expected replaying the moves after undo to draw the same measurements")
+	}
+}
+
+//TestGameWithoutSource tests cloning, playing and undoing a game that was not built by NewGame.
+func TestGameWithoutSource(t *testing.T) {
+	DEBUGAPPLYMOVE = false
+	game := &Game{Board: &Board{}, Entanglements: &Entanglements{}, Pieces: &Pieces{}, ToMove: WHITE}
+	if err := SetupInitialQuantumChess(game.Board, game.Entanglements, game.Pieces); err != nil {
+		t.Fatal(err)
+	}
+	clone := game.Clone()
+	if _, err := clone.Apply(Move{Start: 62, End: 45}); err != nil {
+		t.Fatal(err)
+	}
+	if err := clone.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if clone.rng != nil || clone.Board.rng != nil || clone.Board.getID(62) != game.Board.getID(62) {
+		t.Errorf("Expected the clone to be restored with the global source")
+	}
+}
+
+func TestPreviewMove(t *testing.T) {
+	DEBUGAPPLYMOVE = false
+	board := &Board{Positions: make([]int, 64, 64), Occupancy: make([][2]float64, 64, 64)}
+	entanglements := &Entanglements{List: make(map[int]*Entanglement)}
+	pieces := &Pieces{List: map[int]*Piece{1: __createPiece("Rook", WHITE), 2: __createPiece("Knight", BLACK)}}
+	half := [2]float64{1 / math.Sqrt(2), 0.0}
+	board.Positions[56], board.Occupancy[56] = 1, [2]float64{1.0, 0.0} // a1
+	board.Positions[0], board.Occupancy[0] = 2, half                   // a8
+	board.Positions[7], board.Occupancy[7] = 2, half                   // h8
+	board.InitHash(entanglements, pieces, WHITE)
+	hash := board.Hash
+
+	preview, err := PreviewMove(board, entanglements, pieces, Move{Start: 56, End: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Outcomes) != 2 {
+		t.Fatalf("Expected 2 outcomes, got %+v", preview.Outcomes)
+	}
+	if math.Abs(preview.CaptureProbability-0.5) > 1e-9 {
+		t.Errorf("Expected capture probability 0.5, got %v", preview.CaptureProbability)
+	}
+	if math.Abs(preview.Marginals[2]["Knight"]-0.5) > 1e-9 {
+		t.Errorf("Expected the knight to survive with probability 0.5, got %v", preview.Marginals[2])
+	}
+	for _, outcome := range preview.Outcomes {
+		if len(outcome.Captured) == 0 && (len(outcome.Measured) != 1 || outcome.Measured[0] != 2) {
+			t.Errorf("Expected the knight to be measured when it is not captured, got %+v", outcome)
+		}
+	}
+	if board.Hash != hash || board.Positions[0] != 2 || board.Positions[7] != 2 {
+		t.Errorf("Expected the position to be left unchanged")
+	}
+
+	if _, err := PreviewMove(board, entanglements, pieces, Move{Start: 56, End: 64}); err == nil {
+		t.Errorf("Expected a move off the board to fail")
+	}
+}
+
+func TestMoveEvents(t *testing.T) {
+	DEBUGAPPLYMOVE = false
+	board := &Board{Positions: make([]int, 64, 64)}
+	entanglements := &Entanglements{List: make(map[int]*Entanglement)}
+	pieces := &Pieces{List: map[int]*Piece{1: __createPiece("Rook", WHITE), 2: __createPiece("Knight", BLACK)}}
+	half := [2]float64{1 / math.Sqrt(2), 0.0}
+	pieces.List[2].StateSpace = []string{"Knight", "Bishop"}
+	pieces.List[2].State = map[string][2]float64{"Knight": half, "Bishop": half}
+	board.Positions[56] = 1 // a1
+	board.Positions[0] = 2  // a8
+
+	events, err := ApplyMove(board, entanglements, pieces, 56, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected a measurement and a capture, got %+v", events)
+	}
+	measurement, capture := events[0], events[1]
+	if measurement.Type != EVENT_MEASUREMENT || measurement.Piece != 2 || measurement.Square != 0 ||
+		math.Abs(measurement.Probability-0.5) > 1e-9 {
+		t.Errorf("Expected the knight to be measured with probability 0.5, got %+v", measurement)
+	}
+	if capture.Type != EVENT_CAPTURE || capture.Piece != 2 || capture.Square != 0 {
+		t.Errorf("Expected the knight to be captured on a8, got %+v", capture)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	DEBUGAPPLYMOVE = false
+	game, err := NewGame("standard", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.LastDelta() != nil {
+		t.Errorf("Expected no delta before the first move")
+	}
+	pawn := game.Board.getID(52)
+	if _, err := game.Apply(Move{Start: 52, End: 36}); err != nil { // e4
+		t.Fatal(err)
+	}
+	delta := game.LastDelta()
+	if len(delta.Squares) != 2 || delta.Squares[52] != 0 || delta.Squares[36] != pawn {
+		t.Errorf("Expected e2 to be emptied and e4 to hold piece %d, got %v", pawn, delta.Squares)
+	}
+	if change := delta.Pieces[pawn]; change == nil || !change.Moved {
+		t.Errorf("Expected the pawn to be reported as moved, got %+v", change)
+	}
+	for id := range delta.Pieces {
+		if samePiece(game.positions[0].pieces.List[id], game.Pieces.List[id]) {
+			t.Errorf("Expected only changed pieces in the delta, got piece %d", id)
+		}
+	}
+}
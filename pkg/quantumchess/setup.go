@@ -0,0 +1,323 @@
+package quantumchess
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SetupDefinition describes a starting position: the variant it is played in and every piece on the board.
+// Pieces are given ids in the order they are listed, starting at 1.
+type SetupDefinition struct {
+	Name    string            `json:"name"`
+	Variant string            `json:"variant"` // one of VARIANTS, defaults to Classic
+	Pieces  []PieceDefinition `json:"pieces"`
+}
+
+// PieceDefinition describes a single piece of a SetupDefinition.
+type PieceDefinition struct {
+	Square     string       `json:"square"` // algebraic notation, e.g. "e1"
+	Color      string       `json:"color"`  // "white" or "black"
+	StateSpace []string     `json:"stateSpace"`
+	Amplitudes [][2]float64 `json:"amplitudes"` // defaults to the first state of StateSpace
+	Action     string       `json:"action"`     // one of ACTIONS, defaults to None
+}
+
+var setups = make(map[string]*SetupDefinition)
+
+func init() {
+	for _, document := range []string{standardSetup, splitSetup} {
+		definition, err := LoadSetup(strings.NewReader(document))
+		if err != nil {
+			// the setup stays unregistered, games using it fail to be created with an InvalidSetup error
+			fmt.Println("Unable to load built-in setup:", err)
+			continue
+		}
+		RegisterSetup(definition)
+	}
+}
+
+// RegisterSetup adds a setup to the registry, replacing any setup with the same name.
+func RegisterSetup(definition *SetupDefinition) {
+	setups[definition.Name] = definition
+}
+
+// GetSetup returns the registered setup with the given name, or generates it for Quantum960 names like "quantum960-42".
+// Returns an InvalidSetup error if no such setup is registered.
+func GetSetup(name string) (*SetupDefinition, error) {
+	if seed, ok := ParseQuantum960(name); ok {
+		return GenerateQuantum960(seed), nil
+	}
+	definition, ok := setups[name]
+	if !ok {
+		return nil, InvalidSetup(fmt.Sprintf("no setup named %v", name))
+	}
+	return definition, nil
+}
+
+// Setups returns the sorted names of all registered setups.
+func Setups() []string {
+	names := make([]string, 0, len(setups))
+	for name := range setups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadSetup decodes a JSON setup document and validates it.
+func LoadSetup(r io.Reader) (*SetupDefinition, error) {
+	definition := &SetupDefinition{}
+	if err := json.NewDecoder(r).Decode(definition); err != nil {
+		return nil, InvalidSetup(err.Error())
+	}
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+	return definition, nil
+}
+
+// LoadSetupsFromDir loads and registers every .json setup document in dir.
+func LoadSetupsFromDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return err
+		}
+		definition, err := LoadSetup(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%v: %v", file.Name(), err)
+		}
+		RegisterSetup(definition)
+	}
+	return nil
+}
+
+// Validate checks that the setup can be applied to a board.
+// Returns an InvalidSetup error describing the first problem found.
+func (definition *SetupDefinition) Validate() error {
+	if definition.Name == "" {
+		return InvalidSetup("missing name")
+	}
+	if definition.Variant != "" && !validVariant(definition.Variant) {
+		return InvalidSetup(fmt.Sprintf("unknown variant %v", definition.Variant))
+	}
+	if len(definition.Pieces) == 0 {
+		return InvalidSetup("no pieces")
+	}
+	occupied := make(map[int]bool)
+	for _, p := range definition.Pieces {
+		square, err := ParseSquare(p.Square)
+		if err != nil {
+			return err
+		}
+		if occupied[square] {
+			return InvalidSetup(fmt.Sprintf("square %v is used twice", p.Square))
+		}
+		occupied[square] = true
+		if _, err := parseColor(p.Color); err != nil {
+			return err
+		}
+		if len(p.StateSpace) == 0 {
+			return InvalidSetup(fmt.Sprintf("piece on %v has no state space", p.Square))
+		}
+		for _, state := range p.StateSpace {
+			if _, err := GetPieceType(state); err != nil {
+				return InvalidSetup(fmt.Sprintf("piece on %v: %v", p.Square, err))
+			}
+		}
+		if p.Action != "" && !validAction(p.Action) {
+			return InvalidSetup(fmt.Sprintf("piece on %v: %v", p.Square, InvalidAction(p.Action)))
+		}
+		if p.Amplitudes != nil {
+			if len(p.Amplitudes) != len(p.StateSpace) {
+				return InvalidSetup(fmt.Sprintf("piece on %v has %d amplitudes for %d states",
+					p.Square, len(p.Amplitudes), len(p.StateSpace)))
+			}
+			total := 0.0
+			for _, amplitude := range p.Amplitudes {
+				total += probability(amplitude)
+			}
+			if math.Abs(total-1.0) > 1e-6 {
+				return InvalidSetup(fmt.Sprintf("amplitudes of piece on %v are not normalized", p.Square))
+			}
+		}
+	}
+	return nil
+}
+
+// ApplySetup sets up board, entanglements and pieces from a setup definition.
+func ApplySetup(definition *SetupDefinition, board *Board, entanglements *Entanglements, pieces *Pieces) error {
+	if err := definition.Validate(); err != nil {
+		return err
+	}
+	board.Positions = make([]int, 64, 64)
+	board.Occupancy = nil
+	if definition.Variant == "Split" {
+		board.Occupancy = make([][2]float64, 64, 64)
+	}
+	entanglements.List = make(map[int]*Entanglement)
+	pieces.List = make(map[int]*Piece)
+
+	for i, p := range definition.Pieces {
+		id := i + 1
+		square, _ := ParseSquare(p.Square)
+		color, _ := parseColor(p.Color)
+		pieces.List[id] = p.createPiece(color)
+		board.Positions[square] = id
+		if board.Occupancy != nil {
+			board.Occupancy[square] = [2]float64{1.0, 0.0}
+		}
+		entanglements.List[id] = nil
+	}
+	board.InitHash(entanglements, pieces, WHITE)
+	return nil
+}
+
+func (p PieceDefinition) createPiece(color int) *Piece {
+	action := p.Action
+	if action == "" {
+		action = "None"
+	}
+	initialState := make(map[string][2]float64)
+	for i, state := range p.StateSpace {
+		if p.Amplitudes != nil {
+			initialState[state] = p.Amplitudes[i]
+		} else if i == 0 {
+			initialState[state] = [2]float64{1.0, 0.0}
+		} else {
+			initialState[state] = [2]float64{0.0, 0.0}
+		}
+	}
+	stateSpace := make([]string, len(p.StateSpace))
+	copy(stateSpace, p.StateSpace)
+	return &Piece{Action: action, Color: color, InitialState: initialState,
+		StateSpace: stateSpace, State: __copyMap(initialState), Moved: false}
+}
+
+// ParseSquare converts a square in algebraic notation, e.g. "e1", to its index on the board.
+func ParseSquare(square string) (int, error) {
+	if len(square) != 2 || square[0] < 'a' || square[0] > 'h' || square[1] < '1' || square[1] > '8' {
+		return -1, InvalidSetup(fmt.Sprintf("invalid square %q", square))
+	}
+	col := int(square[0] - 'a')
+	row := 7 - int(square[1]-'1')
+	return row*8 + col, nil
+}
+
+// SquareName converts an index on the board to algebraic notation, e.g. 60 to "e1".
+func SquareName(pos int) string {
+	return fmt.Sprintf("%c%d", 'a'+pos%8, 8-getRow(pos))
+}
+
+func parseColor(color string) (int, error) {
+	if color == "white" {
+		return WHITE, nil
+	} else if color == "black" {
+		return BLACK, nil
+	}
+	return -1, InvalidSetup(fmt.Sprintf("invalid color %q", color))
+}
+
+func validVariant(variant string) bool {
+	for _, v := range VARIANTS {
+		if v == variant {
+			return true
+		}
+	}
+	return false
+}
+
+// standardSetup is the default Classic setup: every piece is superposed with a Pawn, and every Pawn with a piece.
+const standardSetup = `{
+	"name": "standard",
+	"variant": "Classic",
+	"pieces": [
+		{"square": "a8", "color": "black", "stateSpace": ["Rook", "Pawn"], "amplitudes": [[0.7071067811865475, 0], [0.7071067811865476, 0]], "action": "Measurement"},
+		{"square": "b8", "color": "black", "stateSpace": ["Knight", "Pawn"], "amplitudes": [[0.7071067811865475, 0], [0.7071067811865476, 0]], "action": "PauliX"},
+		{"square": "c8", "color": "black", "stateSpace": ["Bishop", "Pawn"], "amplitudes": [[0.7071067811865475, 0], [0.7071067811865476, 0]], "action": "SqrtNOT"},
+		{"square": "d8", "color": "black", "stateSpace": ["King"], "amplitudes": [[1, 0]], "action": "None"},
+		{"square": "e8", "color": "black", "stateSpace": ["Queen", "Pawn"], "amplitudes": [[0.7071067811865475, 0], [0.7071067811865476, 0]], "action": "Hadamard"},
+		{"square": "f8", "color": "black", "stateSpace": ["Bishop", "Pawn"], "amplitudes": [[0.7071067811865475, 0], [0.7071067811865476, 0]], "action": "SqrtNOT"},
+		{"square": "g8", "color": "black", "stateSpace": ["Knight", "Pawn"], "amplitudes": [[0.7071067811865475, 0], [0.7071067811865476, 0]], "action": "PauliX"},
+		{"square": "h8", "color": "black", "stateSpace": ["Rook", "Pawn"], "amplitudes": [[0.7071067811865475, 0], [0.7071067811865476, 0]], "action": "Measurement"},
+		{"square": "a7", "color": "black", "stateSpace": ["Pawn", "Rook"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "b7", "color": "black", "stateSpace": ["Pawn", "Knight"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "c7", "color": "black", "stateSpace": ["Pawn", "Bishop"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "d7", "color": "black", "stateSpace": ["Pawn", "King"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "e7", "color": "black", "stateSpace": ["Pawn", "Queen"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "f7", "color": "black", "stateSpace": ["Pawn", "Bishop"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "g7", "color": "black", "stateSpace": ["Pawn", "Knight"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "h7", "color": "black", "stateSpace": ["Pawn", "Rook"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "a2", "color": "white", "stateSpace": ["Pawn", "Rook"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "b2", "color": "white", "stateSpace": ["Pawn", "Knight"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "c2", "color": "white", "stateSpace": ["Pawn", "Bishop"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "d2", "color": "white", "stateSpace": ["Pawn", "Queen"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "e2", "color": "white", "stateSpace": ["Pawn", "King"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "f2", "color": "white", "stateSpace": ["Pawn", "Bishop"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "g2", "color": "white", "stateSpace": ["Pawn", "Knight"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "h2", "color": "white", "stateSpace": ["Pawn", "Rook"], "amplitudes": [[1, 0], [0, 0]], "action": "PauliZ"},
+		{"square": "a1", "color": "white", "stateSpace": ["Rook", "Pawn"], "amplitudes": [[0.7071067811865475, 0], [0.7071067811865476, 0]], "action": "Measurement"},
+		{"square": "b1", "color": "white", "stateSpace": ["Knight", "Pawn"], "amplitudes": [[0.7071067811865475, 0], [0.7071067811865476, 0]], "action": "PauliX"},
+		{"square": "c1", "color": "white", "stateSpace": ["Bishop", "Pawn"], "amplitudes": [[0.7071067811865475, 0], [0.7071067811865476, 0]], "action": "SqrtNOT"},
+		{"square": "d1", "color": "white", "stateSpace": ["Queen", "Pawn"], "amplitudes": [[0.7071067811865475, 0], [0.7071067811865476, 0]], "action": "Hadamard"},
+		{"square": "e1", "color": "white", "stateSpace": ["King"], "amplitudes": [[1, 0]], "action": "None"},
+		{"square": "f1", "color": "white", "stateSpace": ["Bishop", "Pawn"], "amplitudes": [[0.7071067811865475, 0], [0.7071067811865476, 0]], "action": "SqrtNOT"},
+		{"square": "g1", "color": "white", "stateSpace": ["Knight", "Pawn"], "amplitudes": [[0.7071067811865475, 0], [0.7071067811865476, 0]], "action": "PauliX"},
+		{"square": "h1", "color": "white", "stateSpace": ["Rook", "Pawn"], "amplitudes": [[0.7071067811865475, 0], [0.7071067811865476, 0]], "action": "Measurement"}
+	]
+}`
+
+// splitSetup is the regular chess setup used by the Split variant.
+const splitSetup = `{
+	"name": "split",
+	"variant": "Split",
+	"pieces": [
+		{"square": "a8", "color": "black", "stateSpace": ["Rook"]},
+		{"square": "b8", "color": "black", "stateSpace": ["Knight"]},
+		{"square": "c8", "color": "black", "stateSpace": ["Bishop"]},
+		{"square": "d8", "color": "black", "stateSpace": ["Queen"]},
+		{"square": "e8", "color": "black", "stateSpace": ["King"]},
+		{"square": "f8", "color": "black", "stateSpace": ["Bishop"]},
+		{"square": "g8", "color": "black", "stateSpace": ["Knight"]},
+		{"square": "h8", "color": "black", "stateSpace": ["Rook"]},
+		{"square": "a7", "color": "black", "stateSpace": ["Pawn"]},
+		{"square": "b7", "color": "black", "stateSpace": ["Pawn"]},
+		{"square": "c7", "color": "black", "stateSpace": ["Pawn"]},
+		{"square": "d7", "color": "black", "stateSpace": ["Pawn"]},
+		{"square": "e7", "color": "black", "stateSpace": ["Pawn"]},
+		{"square": "f7", "color": "black", "stateSpace": ["Pawn"]},
+		{"square": "g7", "color": "black", "stateSpace": ["Pawn"]},
+		{"square": "h7", "color": "black", "stateSpace": ["Pawn"]},
+		{"square": "a2", "color": "white", "stateSpace": ["Pawn"]},
+		{"square": "b2", "color": "white", "stateSpace": ["Pawn"]},
+		{"square": "c2", "color": "white", "stateSpace": ["Pawn"]},
+		{"square": "d2", "color": "white", "stateSpace": ["Pawn"]},
+		{"square": "e2", "color": "white", "stateSpace": ["Pawn"]},
+		{"square": "f2", "color": "white", "stateSpace": ["Pawn"]},
+		{"square": "g2", "color": "white", "stateSpace": ["Pawn"]},
+		{"square": "h2", "color": "white", "stateSpace": ["Pawn"]},
+		{"square": "a1", "color": "white", "stateSpace": ["Rook"]},
+		{"square": "b1", "color": "white", "stateSpace": ["Knight"]},
+		{"square": "c1", "color": "white", "stateSpace": ["Bishop"]},
+		{"square": "d1", "color": "white", "stateSpace": ["Queen"]},
+		{"square": "e1", "color": "white", "stateSpace": ["King"]},
+		{"square": "f1", "color": "white", "stateSpace": ["Bishop"]},
+		{"square": "g1", "color": "white", "stateSpace": ["Knight"]},
+		{"square": "h1", "color": "white", "stateSpace": ["Rook"]}
+	]
+}`
@@ -0,0 +1,164 @@
+package quantumchess
+
+import (
+	"fmt"
+)
+
+// castle performs castling when the king moves two squares along its row.
+// The rook is the first piece beyond the king's destination, and lands on the square the king passed over.
+// Castling is invalid if the king may be attacked, with any probability, on its square, on the square it passes
+// over or on its destination.
+// A rook superposed with another type is measured first: castling only happens with its Rook branch,
+// otherwise the move is consumed and the king stays on its square.
+// Returns true if the move was a castling move.
+func castle(board *Board, entanglements *Entanglements, pieces *Pieces, startSquare int, endSquare int) (bool, error) {
+	kingID := board.getID(startSquare)
+	king := pieces.List[kingID]
+	if king == nil || !determinedAs(king, "King") {
+		return false, nil
+	}
+	if getRow(startSquare) != getRow(endSquare) || (endSquare-startSquare != 2 && endSquare-startSquare != -2) {
+		return false, nil
+	}
+	if king.Moved {
+		return false, InvalidMove(endSquare)
+	}
+	dx := sign(endSquare - startSquare)
+	passed := startSquare + dx
+
+	rookSquare := -1
+	for pos, ok := step(endSquare, dx, 0); ok; pos, ok = step(pos, dx, 0) {
+		if board.getID(pos) != 0 {
+			rookSquare = pos
+			break
+		}
+	}
+	if rookSquare == -1 {
+		return false, InvalidMove(endSquare)
+	}
+	rookID := board.getID(rookSquare)
+	rook := pieces.List[rookID]
+	if rook == nil || rook.Color != king.Color || rook.Moved {
+		return false, InvalidMove(endSquare)
+	}
+	if _, ok := rook.State["Rook"]; !ok || !nonZero(rook.State["Rook"]) {
+		return false, InvalidMove(endSquare)
+	}
+	for _, pos := range []int{passed, endSquare} {
+		if board.getID(pos) != 0 && !occupancyUncertain(board, pos) {
+			return false, InvalidMove(endSquare)
+		}
+	}
+	// the king cannot castle out of, through or into a square where it may be attacked
+	for _, pos := range []int{startSquare, passed, endSquare} {
+		if checkProbabilityOn(board, pieces, startSquare, pos, king.Color) > 0 {
+			return false, InvalidMove(endSquare)
+		}
+	}
+
+	if DEBUGAPPLYMOVE {
+		fmt.Println("Castling with the rook on ", rookSquare)
+	}
+	// SPLIT VARIANT: the squares between king and rook must be empty, and both must really be there
+	if board.Occupancy != nil {
+		for _, pos := range pathBetween(startSquare, rookSquare) {
+			if pid := board.getID(pos); pid != 0 && measurePosition(board, pid) == pos {
+				return true, nil
+			}
+		}
+		if occupancyUncertain(board, startSquare) && measurePosition(board, kingID) != startSquare {
+			return true, nil
+		}
+		if occupancyUncertain(board, rookSquare) && measurePosition(board, rookID) != rookSquare {
+			return true, nil
+		}
+	}
+
+	if len(rook.StateSpace) > 1 && !determinedAs(rook, "Rook") {
+		measure(board, pieces, entanglements, rookID)
+		if !determinedAs(rook, "Rook") {
+			if DEBUGAPPLYMOVE {
+				fmt.Println("Rook was measured in a different state, castling failed")
+			}
+			return true, nil
+		}
+	}
+
+	move(board, pieces, startSquare, endSquare)
+	move(board, pieces, rookSquare, passed)
+	return true, nil
+}
+
+// enPassant performs an en passant capture when a piece with a Pawn branch moves diagonally forward onto
+// the en passant square. Both pieces are measured first: the capture only happens if the moving piece is
+// a Pawn and the piece that moved two squares was moved as a Pawn.
+// When the measurements rule the capture out, a Pawn cannot move diagonally onto the empty square: the move is
+// consumed by the measurements, unless the moving piece can make it as a regular move.
+// Returns true if the move was handled, false if it should be applied as a regular move.
+func enPassant(board *Board, entanglements *Entanglements, pieces *Pieces,
+	startSquare int, endSquare int, enPassantSquare int) (bool, error) {
+	if enPassantSquare == 0 || endSquare != enPassantSquare || board.getID(endSquare) != 0 {
+		return false, nil
+	}
+	moverID := board.getID(startSquare)
+	mover := pieces.List[moverID]
+	if mover == nil || !nonZero(mover.State["Pawn"]) {
+		return false, nil
+	}
+	if getRow(endSquare)-getRow(startSquare) != pawnDirection(mover.Color) ||
+		(endSquare%8-startSquare%8 != 1 && endSquare%8-startSquare%8 != -1) {
+		return false, nil
+	}
+	capturedSquare := getRow(startSquare)*8 + endSquare%8
+	capturedID := board.getID(capturedSquare)
+	captured := pieces.List[capturedID]
+	if captured == nil || captured.Color == mover.Color || !nonZero(captured.State["Pawn"]) {
+		return false, nil
+	}
+
+	if DEBUGAPPLYMOVE {
+		fmt.Println("Checking en passant capture on ", capturedSquare)
+	}
+	if occupancyUncertain(board, capturedSquare) && measurePosition(board, capturedID) != capturedSquare {
+		return !canMove(board, pieces, startSquare, endSquare), nil
+	}
+	measure2(board, pieces, entanglements, moverID, capturedID)
+	if !determinedAs(mover, "Pawn") || !determinedAs(captured, "Pawn") {
+		return !canMove(board, pieces, startSquare, endSquare), nil
+	}
+	err := processCapture(board, entanglements, pieces, capturedSquare)
+	if err != nil {
+		return true, err
+	}
+	move(board, pieces, startSquare, endSquare)
+	return true, nil
+}
+
+// canMove checks whether the piece on start can move to end as a regular move in its current states.
+func canMove(board *Board, pieces *Pieces, start int, end int) bool {
+	piece := pieces.List[board.getID(start)]
+	if piece == nil {
+		return false
+	}
+	moves, err := piece.getMoves(board, start, pieces)
+	return err == nil && find(moves, end)
+}
+
+// doublePushSquare returns the square passed over when a piece with a Pawn branch moves two squares forward,
+// 0 otherwise.
+func doublePushSquare(board *Board, pieces *Pieces, startSquare int, endSquare int) int {
+	piece := pieces.List[board.getID(startSquare)]
+	if piece == nil || !nonZero(piece.State["Pawn"]) {
+		return 0
+	}
+	if endSquare-startSquare != 16*pawnDirection(piece.Color) {
+		return 0
+	}
+	return (startSquare + endSquare) / 2
+}
+
+// determinedAs checks whether the piece is in the given state with certainty.
+func determinedAs(piece *Piece, state string) bool {
+	amplitude, ok := piece.State[state]
+	return ok && probability(amplitude) > 1.0-1e-9
+}
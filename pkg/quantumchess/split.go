@@ -0,0 +1,326 @@
+package quantumchess
+
+import (
+	"fmt"
+	"math"
+)
+
+// STANDARD_MOVE is the move type of a regular move from one square to another
+var STANDARD_MOVE int = 0
+
+// SPLIT_MOVE is the move type of a piece splitting from one square onto two squares
+var SPLIT_MOVE int = 1
+
+// MERGE_MOVE is the move type of a piece merging from two squares onto one square
+var MERGE_MOVE int = 2
+
+// SetupSplitQuantumChess sets up the initial board of the Split variant from the "split" setup.
+// Pieces are in a determined type and only their position is allowed to be in superposition.
+// Returns an error if the setup is not registered or cannot be applied.
+func SetupSplitQuantumChess(board *Board, entanglements *Entanglements, pieces *Pieces) error {
+	definition, err := GetSetup("split")
+	if err != nil {
+		return err
+	}
+	return ApplySetup(definition, board, entanglements, pieces)
+}
+
+// ApplySplitMove splits the piece on source onto the squares target1 and target2, each receiving
+// half of the probability of the piece being on source. Only valid in the Split variant.
+// Returns the events of the move, and nil if successful or an appropriate error if the assumptions are not met.
+func ApplySplitMove(board *Board, entanglements *Entanglements, pieces *Pieces,
+	source int, target1 int, target2 int) (events []Event, err error) {
+	board.events = nil
+	defer func() {
+		board.updateHash(entanglements, pieces, err == nil)
+		events = board.takeEvents()
+	}()
+	if DEBUGAPPLYMOVE {
+		fmt.Println("Splitting piece from ", source, " to ", target1, " and ", target2)
+	}
+	if board.Occupancy == nil {
+		return nil, InvalidVariant("Classic")
+	}
+	if !inBoard(source) || !inBoard(target1) || !inBoard(target2) || target1 == target2 {
+		return nil, InvalidMove(target2)
+	}
+	id := board.getID(source)
+	if id == 0 {
+		return nil, InvalidPiece(source)
+	}
+	if pieces.List[id] == nil {
+		return nil, InvalidPieceAccess(id)
+	}
+	for _, target := range []int{target1, target2} {
+		if target == source || board.getID(target) != 0 {
+			return nil, InvalidMove(target)
+		}
+	}
+
+	for _, target := range []int{target1, target2} {
+		if err := checkPath(board, source, target); err != nil {
+			return nil, err
+		}
+	}
+	for _, target := range []int{target1, target2} {
+		blocked, err := measurePath(board, source, target)
+		if err != nil {
+			return nil, err
+		}
+		if blocked || board.getID(source) != id {
+			if DEBUGAPPLYMOVE {
+				fmt.Println("Split blocked after measurement")
+			}
+			return nil, nil
+		}
+	}
+
+	board.EnPassant = 0
+	board.markChanged(id)
+	half := cmplxMult(board.Occupancy[source], [2]float64{1 / math.Sqrt(2), 0.0})
+	board.Positions[source] = 0
+	board.Occupancy[source] = [2]float64{0.0, 0.0}
+	board.Positions[target1] = id
+	board.Occupancy[target1] = half
+	board.Positions[target2] = id
+	board.Occupancy[target2] = half
+	pieces.List[id].Moved = true
+	return nil, nil
+}
+
+// ApplyMergeMove merges the piece on source1 and source2 onto target, adding the probabilities of the piece
+// being on either square. target may be one of the sources. Only valid in the Split variant.
+// Returns the events of the move, and nil if successful or an appropriate error if the assumptions are not met.
+func ApplyMergeMove(board *Board, entanglements *Entanglements, pieces *Pieces,
+	source1 int, source2 int, target int) (events []Event, err error) {
+	board.events = nil
+	defer func() {
+		board.updateHash(entanglements, pieces, err == nil)
+		events = board.takeEvents()
+	}()
+	if DEBUGAPPLYMOVE {
+		fmt.Println("Merging piece from ", source1, " and ", source2, " to ", target)
+	}
+	if board.Occupancy == nil {
+		return nil, InvalidVariant("Classic")
+	}
+	if !inBoard(source1) || !inBoard(source2) || !inBoard(target) || source1 == source2 {
+		return nil, InvalidMove(target)
+	}
+	id := board.getID(source1)
+	if id == 0 {
+		return nil, InvalidPiece(source1)
+	}
+	if board.getID(source2) != id {
+		return nil, InvalidPiece(source2)
+	}
+	if pieces.List[id] == nil {
+		return nil, InvalidPieceAccess(id)
+	}
+	if board.getID(target) != 0 && board.getID(target) != id {
+		return nil, InvalidMove(target)
+	}
+
+	for _, source := range []int{source1, source2} {
+		if source == target {
+			continue
+		}
+		if err := checkPath(board, source, target); err != nil {
+			return nil, err
+		}
+	}
+	for _, source := range []int{source1, source2} {
+		if source == target {
+			continue
+		}
+		blocked, err := measurePath(board, source, target)
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			if DEBUGAPPLYMOVE {
+				fmt.Println("Merge blocked after measurement")
+			}
+			return nil, nil
+		}
+	}
+
+	board.EnPassant = 0
+	mergeSquares(board, id, []int{source1, source2, target}, target)
+	pieces.List[id].Moved = true
+	return nil, nil
+}
+
+// resolveOccupancy performs the measurements a standard move needs in the Split variant before it can be applied.
+// Returns true if the move should proceed as a regular move, false if the move was consumed by the measurements
+// or fully handled here.
+func resolveOccupancy(board *Board, pieces *Pieces, startSquare int, endSquare int) (bool, error) {
+	id := board.getID(startSquare)
+	if id == 0 {
+		return false, InvalidPiece(startSquare)
+	}
+	if pieces.List[id] == nil {
+		return false, InvalidPieceAccess(id)
+	}
+
+	blocked, err := measurePath(board, startSquare, endSquare)
+	if err != nil {
+		return false, err
+	}
+	if blocked || board.getID(startSquare) != id {
+		if DEBUGAPPLYMOVE {
+			fmt.Println("Move blocked after measurement")
+		}
+		return false, nil
+	}
+
+	target := board.getID(endSquare)
+	if target == id { // moving onto another part of itself merges both parts
+		mergeSquares(board, id, []int{startSquare, endSquare}, endSquare)
+		pieces.List[id].Moved = true
+		return false, nil
+	}
+
+	if target != 0 && pieces.List[target] != nil && pieces.List[target].Color != pieces.List[id].Color {
+		// a capture only happens if both pieces are really there
+		if occupancyUncertain(board, startSquare) && measurePosition(board, id) != startSquare {
+			return false, nil
+		}
+		if occupancyUncertain(board, endSquare) {
+			measurePosition(board, target)
+		}
+	}
+	return true, nil
+}
+
+// checkPath returns an error if a square strictly between start and end holds a piece in a determined position.
+// It does not measure anything, so moves can be validated before any measurement changes the board.
+func checkPath(board *Board, start int, end int) error {
+	for _, square := range pathBetween(start, end) {
+		if board.getID(square) != 0 && !occupancyUncertain(board, square) {
+			return InvalidMove(end)
+		}
+	}
+	return nil
+}
+
+// measurePath measures every uncertain square strictly between start and end.
+// Returns true if the path is blocked by a piece after measurement.
+// Returns an error, before measuring anything, if the path is blocked by a piece in a determined position.
+func measurePath(board *Board, start int, end int) (bool, error) {
+	if err := checkPath(board, start, end); err != nil {
+		return false, err
+	}
+	for _, square := range pathBetween(start, end) {
+		pid := board.getID(square)
+		if pid == 0 {
+			continue
+		}
+		// a measurement along the path can leave a piece certainly on a later square
+		if !occupancyUncertain(board, square) || measurePosition(board, pid) == square {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// measurePosition collapses the position of the piece with the given id onto a single square,
+// chosen according to the occupancy probability of each square it is on.
+// Returns the square the piece was measured on.
+func measurePosition(board *Board, id int) int {
+	var squares []int
+	var probabilities []float64
+	for pos, pid := range board.Positions {
+		if pid == id {
+			squares = append(squares, pos)
+			probabilities = append(probabilities, probability(board.Occupancy[pos]))
+		}
+	}
+	if len(squares) == 0 {
+		return -1
+	}
+	board.markChanged(id)
+	index := board.choose(probabilities)
+	selected := squares[index]
+	total := 0.0
+	for _, p := range probabilities {
+		total += p
+	}
+	if total > 0 {
+		board.record(Event{Type: EVENT_MEASUREMENT, Piece: id, Square: selected, Outcome: SquareName(selected),
+			Probability: probabilities[index] / total})
+	}
+
+	for _, pos := range squares {
+		if pos == selected {
+			board.Occupancy[pos] = [2]float64{1.0, 0.0}
+		} else {
+			board.Positions[pos] = 0
+			board.Occupancy[pos] = [2]float64{0.0, 0.0}
+		}
+	}
+	if DEBUGAPPLYMOVE {
+		fmt.Println("Measured piece ", id, " on square ", selected)
+	}
+	return selected
+}
+
+// mergeSquares gathers the occupancy of the piece id on the given squares onto target.
+func mergeSquares(board *Board, id int, squares []int, target int) {
+	board.markChanged(id)
+	total := 0.0
+	counted := make(map[int]bool)
+	for _, pos := range squares {
+		if counted[pos] || board.getID(pos) != id {
+			continue
+		}
+		counted[pos] = true
+		total += probability(board.Occupancy[pos])
+		board.Positions[pos] = 0
+		board.Occupancy[pos] = [2]float64{0.0, 0.0}
+	}
+	board.Positions[target] = id
+	board.Occupancy[target] = [2]float64{math.Sqrt(math.Min(total, 1.0)), 0.0}
+}
+
+// occupancyUncertain checks whether the piece on square might not actually be there.
+func occupancyUncertain(board *Board, square int) bool {
+	if board.Occupancy == nil || board.getID(square) == 0 {
+		return false
+	}
+	return probability(board.Occupancy[square]) < 1.0-1e-9
+}
+
+// probability returns the squared modulus of a complex amplitude
+func probability(cmplx [2]float64) float64 {
+	return cmplx[0]*cmplx[0] + cmplx[1]*cmplx[1]
+}
+
+// pathBetween returns the squares strictly between start and end when they share a row, column or diagonal.
+// Returns nil for any other pair of squares, e.g. knight jumps.
+func pathBetween(start int, end int) []int {
+	var path []int
+	dRow := getRow(end) - getRow(start)
+	dCol := end%8 - start%8
+	if dRow != 0 && dCol != 0 && dRow != dCol && dRow != -dCol {
+		return path
+	}
+	stepRow, stepCol := sign(dRow), sign(dCol)
+	step := stepRow*8 + stepCol
+	if step == 0 {
+		return path
+	}
+	for pos := start + step; pos != end; pos += step {
+		path = append(path, pos)
+	}
+	return path
+}
+
+func sign(x int) int {
+	if x > 0 {
+		return 1
+	} else if x < 0 {
+		return -1
+	}
+	return 0
+}
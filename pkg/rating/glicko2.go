@@ -0,0 +1,113 @@
+package rating
+
+import "math"
+
+// DEFAULT_RATING, DEFAULT_DEVIATION and DEFAULT_VOLATILITY are the rating of a player who has not played yet.
+var (
+	DEFAULT_RATING     float64 = 1500
+	DEFAULT_DEVIATION  float64 = 350
+	DEFAULT_VOLATILITY float64 = 0.06
+)
+
+// TAU constrains the change of volatility over time, reasonable values are between 0.3 and 1.2.
+var TAU float64 = 0.5
+
+// scale converts ratings and deviations between the Glicko and the Glicko-2 scales.
+const scale = 173.7178
+
+// epsilon is the convergence tolerance of the volatility iteration.
+const epsilon = 0.000001
+
+// Rating is the Glicko-2 rating of a player in one category.
+type Rating struct {
+	Rating     float64 `json:"rating"`
+	Deviation  float64 `json:"deviation"`
+	Volatility float64 `json:"volatility"`
+	Games      int     `json:"games"`
+}
+
+// Result is the score of a game against an opponent: 1 for a win, 0.5 for a draw and 0 for a loss.
+type Result struct {
+	Opponent Rating
+	Score    float64
+}
+
+// NewRating returns the rating of a new player.
+func NewRating() Rating {
+	return Rating{Rating: DEFAULT_RATING, Deviation: DEFAULT_DEVIATION, Volatility: DEFAULT_VOLATILITY}
+}
+
+// Update returns the rating of a player after a rating period with the given results.
+// The deviation of a player without results grows with their volatility.
+func Update(player Rating, results []Result) Rating {
+	mu := (player.Rating - DEFAULT_RATING) / scale
+	phi := player.Deviation / scale
+	sigma := player.Volatility
+	if len(results) == 0 {
+		player.Deviation = math.Sqrt(phi*phi+sigma*sigma) * scale
+		return player
+	}
+
+	var variance, improvement float64
+	for _, result := range results {
+		muj := (result.Opponent.Rating - DEFAULT_RATING) / scale
+		g := weight(result.Opponent.Deviation / scale)
+		e := expected(mu, muj, g)
+		variance += g * g * e * (1 - e)
+		improvement += g * (result.Score - e)
+	}
+	v := 1 / variance
+	delta := v * improvement
+
+	sigma = volatility(phi, sigma, v, delta)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * improvement
+
+	return Rating{Rating: mu*scale + DEFAULT_RATING, Deviation: phi * scale, Volatility: sigma,
+		Games: player.Games + len(results)}
+}
+
+// weight reduces the impact of a game with the deviation phi of the opponent.
+func weight(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+// expected returns the expected score of a player of rating mu against an opponent of rating muj.
+func expected(mu float64, muj float64, g float64) float64 {
+	return 1 / (1 + math.Exp(-g*(mu-muj)))
+}
+
+// volatility computes the new volatility with the Illinois algorithm.
+func volatility(phi float64, sigma float64, v float64, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(TAU*TAU)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*TAU) < 0 {
+			k++
+		}
+		B = a - k*TAU
+	}
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
@@ -0,0 +1,95 @@
+package rating
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// TestUpdate checks Update against the example of Glickman's description of the Glicko-2 system.
+func TestUpdate(t *testing.T) {
+	player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+	results := []Result{
+		{Opponent: Rating{Rating: 1400, Deviation: 30}, Score: 1},
+		{Opponent: Rating{Rating: 1550, Deviation: 100}, Score: 0},
+		{Opponent: Rating{Rating: 1700, Deviation: 300}, Score: 0},
+	}
+	updated := Update(player, results)
+	if math.Abs(updated.Rating-1464.06) > 0.01 {
+		t.Errorf("expected rating 1464.06, got %v", updated.Rating)
+	}
+	if math.Abs(updated.Deviation-151.52) > 0.01 {
+		t.Errorf("expected deviation 151.52, got %v", updated.Deviation)
+	}
+	if math.Abs(updated.Volatility-0.05999) > 0.00001 {
+		t.Errorf("expected volatility 0.05999, got %v", updated.Volatility)
+	}
+	if updated.Games != 3 {
+		t.Errorf("expected 3 games, got %v", updated.Games)
+	}
+
+	idle := Update(player, nil)
+	if idle.Rating != player.Rating || idle.Deviation <= player.Deviation {
+		t.Errorf("expected the deviation of an idle player to grow, got %+v", idle)
+	}
+}
+
+// TestCategory checks the time control categories.
+func TestCategory(t *testing.T) {
+	for timeControl, category := range map[string]string{
+		"1+0": BULLET, "2+1": BULLET, "3+0": BLITZ, "5+3": BLITZ, "10+0": RAPID, "15+10": RAPID, "25+0": CLASSICAL, "30": CLASSICAL,
+		"": UNLIMITED, "abc": UNLIMITED, "0+0": UNLIMITED,
+	} {
+		if got := Category(timeControl); got != category {
+			t.Errorf("expected %v to be %v, got %v", timeControl, category, got)
+		}
+	}
+}
+
+// TestRecordGame checks that a game updates both players and the leaderboard.
+func TestRecordGame(t *testing.T) {
+	store := NewMemoryStore()
+	if err := RecordGame(store, BLITZ, "alice", "bob", 1); err != nil {
+		t.Fatal(err)
+	}
+	alice, ok, _ := store.Get("alice", BLITZ)
+	bob, _, _ := store.Get("bob", BLITZ)
+	if !ok || alice.Rating <= DEFAULT_RATING || bob.Rating >= DEFAULT_RATING || alice.Games != 1 {
+		t.Errorf("unexpected ratings after a win: %+v %+v", alice, bob)
+	}
+	if _, ok, _ := store.Get("alice", RAPID); ok {
+		t.Errorf("expected no rapid rating")
+	}
+
+	entries, _ := store.Leaderboard(BLITZ, 1)
+	if len(entries) != 1 || entries[0].Player != "alice" {
+		t.Errorf("expected alice to lead, got %+v", entries)
+	}
+
+	if err := RecordGame(store, BLITZ, "alice", "alice", 1); err != ErrSamePlayer {
+		t.Errorf("expected ErrSamePlayer for a game against oneself, got %v", err)
+	}
+	if same, _, _ := store.Get("alice", BLITZ); same != alice {
+		t.Errorf("expected a game against oneself not to change the rating, got %+v", same)
+	}
+}
+
+// TestRecordGamesConcurrently checks that no result is lost when games of the same player end at the same time.
+func TestRecordGamesConcurrently(t *testing.T) {
+	store := NewMemoryStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(opponent string) {
+			defer wg.Done()
+			if err := RecordGame(store, BLITZ, "alice", opponent, 1); err != nil {
+				t.Error(err)
+			}
+		}("player" + strconv.Itoa(i))
+	}
+	wg.Wait()
+	if alice, _, _ := store.Get("alice", BLITZ); alice.Games != 50 {
+		t.Errorf("expected 50 games for alice, got %v", alice.Games)
+	}
+}
@@ -0,0 +1,161 @@
+package rating
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Time control categories, by the estimated duration of a game: base time plus 40 increments.
+var (
+	BULLET    string = "bullet"    // under 3 minutes
+	BLITZ     string = "blitz"     // under 8 minutes
+	RAPID     string = "rapid"     // under 25 minutes
+	CLASSICAL string = "classical" // 25 minutes or more
+	UNLIMITED string = "unlimited" // no clock
+)
+
+// CATEGORIES lists the time control categories ratings are kept for.
+var CATEGORIES = []string{BULLET, BLITZ, RAPID, CLASSICAL, UNLIMITED}
+
+// Category returns the category of a time control written "minutes+increment", e.g. "5+3" is blitz.
+// Time controls that cannot be parsed are unlimited.
+func Category(timeControl string) string {
+	parts := strings.Split(timeControl, "+")
+	minutes, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || len(parts) > 2 {
+		return UNLIMITED
+	}
+	increment := 0.0
+	if len(parts) == 2 {
+		if increment, err = strconv.ParseFloat(parts[1], 64); err != nil {
+			return UNLIMITED
+		}
+	}
+	switch estimated := minutes*60 + 40*increment; {
+	case estimated <= 0:
+		return UNLIMITED
+	case estimated < 180:
+		return BULLET
+	case estimated < 480:
+		return BLITZ
+	case estimated < 1500:
+		return RAPID
+	default:
+		return CLASSICAL
+	}
+}
+
+// Entry is a player's rating in a leaderboard.
+type Entry struct {
+	Player string `json:"player"`
+	Rating
+}
+
+// Store keeps the ratings of players in each category.
+type Store interface {
+	// Get returns the rating of a player in a category, false if they have no rating in it.
+	Get(player string, category string) (Rating, bool, error)
+	// Put stores the rating of a player in a category.
+	Put(player string, category string, rating Rating) error
+	// Update atomically replaces the ratings of players in a category by the ones update returns for their current
+	// ratings, in the same order. Players without a rating start from NewRating.
+	Update(category string, players []string, update func(ratings []Rating) []Rating) error
+	// Leaderboard returns at most limit ratings of a category from the highest, all of them if limit is not positive.
+	Leaderboard(category string, limit int) ([]Entry, error)
+}
+
+// MemoryStore is a Store that keeps ratings in memory. It is safe for concurrent use.
+type MemoryStore struct {
+	mutex   sync.RWMutex
+	ratings map[string]map[string]Rating // ratings by category, then by player
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{ratings: make(map[string]map[string]Rating)}
+}
+
+// Get returns the rating of a player in a category, false if they have no rating in it.
+func (store *MemoryStore) Get(player string, category string) (Rating, bool, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	rating, ok := store.ratings[category][player]
+	return rating, ok, nil
+}
+
+// Put stores the rating of a player in a category.
+func (store *MemoryStore) Put(player string, category string, rating Rating) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.ratings[category] == nil {
+		store.ratings[category] = make(map[string]Rating)
+	}
+	store.ratings[category][player] = rating
+	return nil
+}
+
+// Update atomically replaces the ratings of players in a category by the ones update returns for their current
+// ratings, in the same order. Players without a rating start from NewRating.
+func (store *MemoryStore) Update(category string, players []string, update func(ratings []Rating) []Rating) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.ratings[category] == nil {
+		store.ratings[category] = make(map[string]Rating)
+	}
+	ratings := make([]Rating, len(players))
+	for i, player := range players {
+		rating, ok := store.ratings[category][player]
+		if !ok {
+			rating = NewRating()
+		}
+		ratings[i] = rating
+	}
+	for i, rating := range update(ratings) {
+		store.ratings[category][players[i]] = rating
+	}
+	return nil
+}
+
+// Leaderboard returns at most limit ratings of a category from the highest, all of them if limit is not positive.
+func (store *MemoryStore) Leaderboard(category string, limit int) ([]Entry, error) {
+	store.mutex.RLock()
+	entries := make([]Entry, 0, len(store.ratings[category]))
+	for player, rating := range store.ratings[category] {
+		entries = append(entries, Entry{Player: player, Rating: rating})
+	}
+	store.mutex.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Rating.Rating != entries[j].Rating.Rating {
+			return entries[i].Rating.Rating > entries[j].Rating.Rating
+		}
+		return entries[i].Player < entries[j].Player
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// ErrSamePlayer is returned when recording a game a player played against themself.
+var ErrSamePlayer = errors.New("a player cannot play a rated game against themself")
+
+// RecordGame updates the ratings of both players of a game in a category, new players start from NewRating.
+// whiteScore is 1 if white won, 0.5 for a draw and 0 if black won.
+// Returns ErrSamePlayer, without updating any rating, if white and black are the same player.
+func RecordGame(store Store, category string, white string, black string, whiteScore float64) error {
+	if white == black {
+		return ErrSamePlayer
+	}
+	// both ratings are read and written at once: games of the same player can end at the same time
+	return store.Update(category, []string{white, black}, func(ratings []Rating) []Rating {
+		whiteRating, blackRating := ratings[0], ratings[1]
+		return []Rating{
+			Update(whiteRating, []Result{{Opponent: blackRating, Score: whiteScore}}),
+			Update(blackRating, []Result{{Opponent: whiteRating, Score: 1 - whiteScore}}),
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package websocket
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CHAT_MAX_LENGTH is the maximum number of characters of a chat message
+var CHAT_MAX_LENGTH int = 500
+
+// CHAT_RATE_LIMIT is the number of chat messages a client can send within CHAT_RATE_WINDOW
+var CHAT_RATE_LIMIT int = 5
+
+// CHAT_RATE_WINDOW is the period chat messages are counted over for rate limiting
+var CHAT_RATE_WINDOW time.Duration = 10 * time.Second
+
+// PLAYERS_CHANNEL is the chat channel of the players, that spectators can read too
+var PLAYERS_CHANNEL string = "players"
+
+// SPECTATORS_CHANNEL is the chat channel of the spectators, hidden from the players
+var SPECTATORS_CHANNEL string = "spectators"
+
+// ChatFilter moderates chat messages before they are sent.
+type ChatFilter interface {
+	// Filter returns the text to send in place of text, or false if the message must be dropped.
+	Filter(pid string, text string) (string, bool)
+}
+
+// WordFilter is a ChatFilter that masks the given words with asterisks, ignoring case.
+// It is built by NewWordFilter, which compiles the pattern of each word once.
+type WordFilter struct {
+	Words    []string
+	patterns []*regexp.Regexp
+}
+
+// NewWordFilter builds a WordFilter masking the given words. Empty words are ignored.
+func NewWordFilter(words ...string) *WordFilter {
+	f := &WordFilter{}
+	for _, word := range words {
+		if word == "" {
+			continue
+		}
+		f.Words = append(f.Words, word)
+		f.patterns = append(f.patterns, regexp.MustCompile("(?i)"+regexp.QuoteMeta(word)))
+	}
+	return f
+}
+
+// Filter masks every occurrence of the filtered words.
+func (f *WordFilter) Filter(pid string, text string) (string, bool) {
+	for _, pattern := range f.patterns {
+		text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+			return strings.Repeat("*", len([]rune(match)))
+		})
+	}
+	return text, true
+}
+
+// ChatEntry is a chat message kept in the history of a game.
+type ChatEntry struct {
+	Pid     string    `json:"pid"`
+	Channel string    `json:"channel"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// chat checks a chat message of a client against the limits and filters of the pool, then sends it to its channel.
+// Players write to PLAYERS_CHANNEL, spectators to SPECTATORS_CHANNEL. A rejected message is answered with an error.
+func (pool *GamePool) chat(client *GameClient, text string) {
+	color, ok := pool.Clients[client]
+	if !ok {
+		return
+	}
+	if len([]rune(text)) > CHAT_MAX_LENGTH {
+		client.Send(GameMessage{Type: 2, Error: "message too long"})
+		return
+	}
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	now := time.Now()
+	if !pool.allowChat(client, now) {
+		client.Send(GameMessage{Type: 2, Error: "too many messages"})
+		return
+	}
+	for _, filter := range pool.ChatFilters {
+		if text, ok = filter.Filter(client.ID, text); !ok {
+			client.Send(GameMessage{Type: 2, Error: "message rejected"})
+			return
+		}
+	}
+
+	channel := PLAYERS_CHANNEL
+	if color == SPECTATOR {
+		channel = SPECTATORS_CHANNEL
+	}
+	pool.ChatHistory = append(pool.ChatHistory, ChatEntry{Pid: client.ID, Channel: channel, Message: text, Time: now})
+
+	message := GameMessage{Type: 2, Pid: client.ID, Color: color, Channel: channel, Message: text}
+	for other, otherColor := range pool.Clients {
+		if channel == SPECTATORS_CHANNEL && otherColor != SPECTATOR {
+			continue
+		}
+		if otherColor != SPECTATOR && otherColor != color && pool.Muted[otherColor] {
+			continue
+		}
+		other.Send(message)
+	}
+}
+
+// allowChat records a chat message of the client at time now.
+// Returns false if the client already sent CHAT_RATE_LIMIT messages within CHAT_RATE_WINDOW.
+func (pool *GamePool) allowChat(client *GameClient, now time.Time) bool {
+	return allowRate(pool.chatTimes, client, now, CHAT_RATE_LIMIT, CHAT_RATE_WINDOW)
+}
+
+// allowRate records a request of the client at time now in times, the recent requests of each client.
+// Returns false if the client already made limit requests within window.
+func allowRate(times map[*GameClient][]time.Time, client *GameClient, now time.Time, limit int,
+	window time.Duration) bool {
+	var recent []time.Time
+	for _, sent := range times[client] {
+		if now.Sub(sent) < window {
+			recent = append(recent, sent)
+		}
+	}
+	if len(recent) >= limit {
+		times[client] = recent
+		return false
+	}
+	times[client] = append(recent, now)
+	return true
+}
+
+// mute mutes or unmutes the opponent of a player: a muted opponent's chat messages are not sent to the player.
+func (pool *GamePool) mute(client *GameClient, mute bool) {
+	color, ok := pool.Clients[client]
+	if !ok || (color != WHITE && color != BLACK) {
+		return
+	}
+	pool.Muted[color] = mute
+	client.Send(GameMessage{Type: 9, Mute: mute})
+}
@@ -12,14 +12,38 @@ type Client struct {
 	ID   string
 	Conn *websocket.Conn
 	Pool *Pool
+	out  *outbox
+}
+
+//NewClient creates the client of a lobby connection and starts writing its messages.
+func NewClient(id string, conn *websocket.Conn, pool *Pool) *Client {
+	return &Client{ID: id, Conn: conn, Pool: pool, out: newOutbox(conn)}
+}
+
+//Send queues a message to the client. A client whose queue is full is evicted.
+func (c *Client) Send(message Message) {
+	if !c.out.send(message) {
+		c.Conn.Close()
+	}
 }
 
 //Message target object to decode the JSON messages of the general websocket connection.
 type Message struct {
-	Type    int    `json:type`
-	Players string `json:"players"`
-	ID      string `json:"id"`
-	QueueId string `json:"queue"`
+	Type        int    `json:"Type"` // 0 = player count, 1 = join queue, 2 = leave queue, 3 = match found
+	Players     string `json:"players"`
+	ID          string `json:"id"`
+	QueueId     string `json:"queue"`
+	TimeControl string `json:"timeControl"` // time control of the queue, e.g. "5+3"
+	Variant     string `json:"variant"`     // setup of the queued games
+	GameId      string `json:"gameId"`      // game created for a match found
+	Invite      string `json:"invite"`      // token to join the game of a match found with
+	Error       string `json:"error,omitempty"`
+}
+
+//LobbyMessage is a Message along with the client who sent it.
+type LobbyMessage struct {
+	Client  *Client
+	Message Message
 }
 
 func (c *Client) Read() {
@@ -28,6 +52,7 @@ func (c *Client) Read() {
 		c.Conn.Close()
 	}()
 
+	prepareRead(c.Conn)
 	for {
 		message := &Message{}
 		err := c.Conn.ReadJSON(&message)
@@ -35,7 +60,12 @@ func (c *Client) Read() {
 			log.Println(err)
 			return
 		}
+		extendRead(c.Conn)
 		fmt.Println(message)
+		if message.Type == 1 || message.Type == 2 {
+			c.Pool.Queue <- LobbyMessage{Client: c, Message: *message}
+			continue
+		}
 		c.Pool.Broadcast <- *message
 		fmt.Printf("Message Received: %+v\n", message)
 	}
@@ -0,0 +1,87 @@
+package websocket
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidTimeControl is returned for time controls that are not written "minutes+increment".
+var ErrInvalidTimeControl = errors.New("time controls are written minutes+increment, e.g. 5+3")
+
+// parseTimeControl returns the base time and increment of a time control written "minutes+increment",
+// the increment in seconds. The increment is optional.
+func parseTimeControl(timeControl string) (time.Duration, time.Duration, error) {
+	parts := strings.Split(timeControl, "+")
+	if len(parts) > 2 {
+		return 0, 0, ErrInvalidTimeControl
+	}
+	minutes, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || minutes <= 0 {
+		return 0, 0, ErrInvalidTimeControl
+	}
+	seconds := 0.0
+	if len(parts) == 2 {
+		if seconds, err = strconv.ParseFloat(parts[1], 64); err != nil || seconds < 0 {
+			return 0, 0, ErrInvalidTimeControl
+		}
+	}
+	return time.Duration(minutes * float64(time.Minute)), time.Duration(seconds * float64(time.Second)), nil
+}
+
+// Clock is the chess clock of a game: the time left to each player, only one of them running at a time.
+type Clock struct {
+	Remaining [2]time.Duration // time left to each player when their clock last stopped, indexed by color
+	Increment time.Duration    // added to a player's time after each of their moves
+	Running   int              // color whose time is running, -1 if the clock is stopped
+	started   time.Time        // when the running clock was started
+}
+
+// NewClock creates a stopped clock for the given time control.
+func NewClock(timeControl string) (*Clock, error) {
+	base, increment, err := parseTimeControl(timeControl)
+	if err != nil {
+		return nil, err
+	}
+	return &Clock{Remaining: [2]time.Duration{base, base}, Increment: increment, Running: -1}, nil
+}
+
+// Times returns the time left to each player at the given time, which is negative for a player who ran out of time.
+func (clock *Clock) Times(now time.Time) [2]time.Duration {
+	times := clock.Remaining
+	if clock.Running >= 0 {
+		times[clock.Running] -= now.Sub(clock.started)
+	}
+	return times
+}
+
+// Start stops the clock of the running player, if any, and starts the clock of the given color.
+func (clock *Clock) Start(color int, now time.Time) {
+	clock.Stop(now)
+	clock.Running = color
+	clock.started = now
+}
+
+// Stop stops the clock of the running player.
+func (clock *Clock) Stop(now time.Time) {
+	clock.Remaining = clock.Times(now)
+	clock.Running = -1
+}
+
+// Press ends the turn of the running player: their time gets the increment and the opponent's clock starts.
+func (clock *Clock) Press(now time.Time) {
+	color := clock.Running
+	if color < 0 {
+		return
+	}
+	clock.Stop(now)
+	clock.Remaining[color] += clock.Increment
+	clock.Start(1-color, now)
+}
+
+// Millis returns the time left to each player at the given time in milliseconds, indexed by color.
+func (clock *Clock) Millis(now time.Time) []int64 {
+	times := clock.Times(now)
+	return []int64{times[WHITE].Milliseconds(), times[BLACK].Milliseconds()}
+}
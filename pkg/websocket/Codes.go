@@ -0,0 +1,53 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"strings"
+)
+
+// ROOM_CODE_ALPHABET holds the characters of room codes, without the ones easily confused: 0, O, 1, I and L
+var ROOM_CODE_ALPHABET string = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// ROOM_CODE_LENGTH is the number of characters of room codes
+var ROOM_CODE_LENGTH int = 6
+
+// newRoomCode returns a random room code of ROOM_CODE_LENGTH characters of ROOM_CODE_ALPHABET.
+func newRoomCode() string {
+	code := make([]byte, ROOM_CODE_LENGTH)
+	max := big.NewInt(int64(len(ROOM_CODE_ALPHABET)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		code[i] = ROOM_CODE_ALPHABET[n.Int64()]
+	}
+	return string(code)
+}
+
+// normalizeRoomCode returns the room code a user typed, ignoring case and surrounding spaces.
+func normalizeRoomCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// newToken returns a random secret token, e.g. to join a private room or to rejoin a game.
+func newToken() string {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(token)
+}
+
+// newSeed returns a random non negative seed for the math/rand sources of rooms.
+// The global math/rand source is not seeded before Go 1.20, so its draws would repeat after every restart.
+func newSeed() int64 {
+	seed := make([]byte, 8)
+	if _, err := rand.Read(seed); err != nil {
+		panic(err)
+	}
+	return int64(binary.BigEndian.Uint64(seed) >> 1)
+}
@@ -5,42 +5,92 @@ import (
 	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/quantumchess"
 	"github.com/gorilla/websocket"
 	"log"
-	"strconv"
 )
 //DEBUG_DECODE toggles decoding debug messages in the console.
 var DEBUG_DECODE = true
 
 // GameClient represents a new websocket connection to manage games, with the user's id, and the game pool it is connected to.
 type GameClient struct {
-	ID       string
-	Conn     *websocket.Conn
-	GamePool *GamePool
+	ID        string
+	Conn      *websocket.Conn
+	GamePool  *GamePool
+	Reconnect string // reconnect token the client presented to rejoin a game in progress
+	Invite    string // invite token the client presented to play in a private game
+	out       *outbox
+}
+
+//NewGameClient creates the client of a game connection and starts writing its messages.
+func NewGameClient(id string, conn *websocket.Conn, gamePool *GamePool) *GameClient {
+	return &GameClient{ID: id, Conn: conn, GamePool: gamePool, out: newOutbox(conn)}
+}
+
+//Send queues a message to the client. A client whose queue is full is evicted.
+func (c *GameClient) Send(message GameMessage) {
+	if !c.out.send(message) {
+		c.Conn.Close()
+	}
 }
 
 //GameMessage allows us to unpack the content of JSON transmitted through the game pool.
 type GameMessage struct {
-	Type          int                        `json:"type"` // 0 = player connected, 1 = board update, 2 = message, 3= opponent leave, 4= spectator join/leave
+	Type          int                        `json:"type"` // 0 = player connected, 1 = board update, 2 = message, 3= opponent leave, 4= spectator join/leave, 5 = takeback request, 6 = takeback answer, 7 = move preview, 8 = resync, 9 = mute/unmute opponent, 10 = player reconnected, 11 = game over by timeout or abandonment, 12 = rematch offer
 	Pid           string                     `json:"pid"`
 	Color         int                        `json:"color"`
 	GameStart     bool                       `json:"start"`
 	GameEnd       bool                       `json:"end"`
 	Message       string                     `json:"message"`
 	Move          [2]int                     `json:"move"`
-	Board         [64]int   	  			  `json:"board"`
-	Entanglements map[string]interface{} 	  `json:"entanglements"`
-	Pieces        map[string]interface{}      `json:"pieces"`
-	NewBoard 	  [64]int 					  `json:"newBoard"`
-	NewPieces     quantumchess.Pieces         `json:"newPieces"`
-	NewEntanglements quantumchess.Entanglements `json:"newEntanglements"`
+	MoveType      int                        `json:"moveType"` // 0 = standard, 1 = split (move[0] to targets), 2 = merge (targets to move[1])
+	Targets       [2]int                     `json:"targets"`
+	Promotion     string                     `json:"promotion"` // piece type a pawn reaching the last rank becomes, defaults to Queen
+	Variant       string                     `json:"variant"`
+	Setup         string                     `json:"setup"`
+	// NewBoard, NewPieces, NewEntanglements and NewOccupancy hold the whole position. Board updates only hold a Delta.
+	NewBoard      []int                       `json:"newBoard,omitempty"`
+	NewPieces     *quantumchess.Pieces        `json:"newPieces,omitempty"`
+	NewEntanglements *quantumchess.Entanglements `json:"newEntanglements,omitempty"`
+	NewOccupancy  [][2]float64               `json:"newOccupancy,omitempty"`
+	Delta         *quantumchess.PositionDelta `json:"delta,omitempty"` // changes of the position since the previous seq
+	Seq           int                        `json:"seq"`             // version of the position, increases by one with every change
+	Spectators    int                        `json:"spectators"`      // number of spectators, in spectator join/leave messages
+	Channel       string                     `json:"channel,omitempty"` // chat channel: players or spectators
+	Mute          bool                       `json:"mute"`              // mute or unmute the opponent's chat
+	Error         string                     `json:"error,omitempty"`   // why a request was rejected
+	EnPassant     int                        `json:"enPassant"` // square a pawn can be captured en passant on, 0 if none
+	Check         [2]float64                 `json:"check"`     // probability of each color's king being attacked, indexed by color
+	Checkmate     bool                       `json:"checkmate"`
+	Winner        int                        `json:"winner"` // color of the winner when end is set, -1 for a draw
+	Reason        string                     `json:"reason"` // why the game ended: checkmate, stalemate, repetition or moveLimit
+	ToMove        int                        `json:"toMove"` // color of the player to move
+	Accept        bool                       `json:"accept"` // answer to a takeback request
+	Preview       *quantumchess.Preview      `json:"preview,omitempty"` // possible outcomes of the move of a preview request
+	Events        []quantumchess.Event       `json:"events,omitempty"`  // what happened during the move of a board update
+	Clock         []int64                    `json:"clock,omitempty"`     // milliseconds left to each color, for games with a time control
+	Reconnect     string                     `json:"reconnect,omitempty"` // token to rejoin the game with after a disconnection
+	Grace         int                        `json:"grace,omitempty"`     // seconds a disconnected player has to rejoin
+	White         string                     `json:"white,omitempty"`       // id of the white player, in game start messages
+	Black         string                     `json:"black,omitempty"`       // id of the black player, in game start messages
+	TimeControl   string                     `json:"timeControl,omitempty"` // time control of the game, in game start messages
+	Rematch       int                        `json:"rematch"`               // number of rematches played before this game
+}
+
+//ClientMessage is a GameMessage along with the client who sent it.
+type ClientMessage struct {
+	Client  *GameClient
+	Message GameMessage
 }
 
 //GameRead performs the parsing of JSON message, and then appropriately broadcasts the transformed message to other users.
 func (c *GameClient) GameRead() {
 	defer func() {
-		c.GamePool.Unregister <- c
+		select {
+		case c.GamePool.Unregister <- c:
+		case <-c.GamePool.done:
+		}
 		c.Conn.Close()
 	}()
 
+	prepareRead(c.Conn)
 	for {
 
 		message := &GameMessage{}
@@ -50,132 +100,32 @@ func (c *GameClient) GameRead() {
 			log.Println(err)
 			return
 		}
-		if message.Type == 2{
-			//c.GamePool.Broadcast <- *message
+		extendRead(c.Conn)
+		var channel chan ClientMessage
+		if message.Type == 2 || message.Type == 9 {
+			channel = c.GamePool.Chats
 		} else if message.Type == 1{
-			board := &quantumchess.Board{}
-			pieces := &quantumchess.Pieces{}
-			entanglements := &quantumchess.Entanglements{}
-
-			decodeBoardFromMessage(message, board, pieces, entanglements)
 			if DEBUG_DECODE{ fmt.Println("Moving piece from ", message.Move[0], " to ", message.Move[1])}
-
-			err := quantumchess.ApplyMove(board, entanglements, pieces, message.Move[0], message.Move[1])
-			if err != nil{
-				fmt.Println("Error applying move")
-				log.Println(err)
-			}
-			var newBoard [64]int
-			copy(newBoard[:], board.Positions)
-			updateMessage := GameMessage{
-				Type:1,
-				NewBoard: newBoard,
-				NewPieces: *pieces,
-				NewEntanglements: *entanglements,
-
+			channel = c.GamePool.Moves
+		} else if message.Type == 5 || message.Type == 6 || message.Type == 12 {
+			channel = c.GamePool.Takebacks
+		} else if message.Type == 7 {
+			channel = c.GamePool.Previews
+		} else if message.Type == 8 {
+			select {
+			case c.GamePool.Resyncs <- c:
+			case <-c.GamePool.done:
+				return
 			}
-			c.GamePool.Broadcast <- updateMessage
 		}
-
-
-	}
-}
-
-
-func decodeBoardFromMessage(message *GameMessage, board *quantumchess.Board,
-	pieces *quantumchess.Pieces, entanglements *quantumchess.Entanglements ){
-	board.Positions = message.Board[:]
-	pieces.List = make(map[int]*quantumchess.Piece)
-	entanglements.List = make(map[int]*quantumchess.Entanglement)
-
-	for id,interf := range message.Pieces{
-		newPiece := &quantumchess.Piece{}
-		data:= interf.(map[string]interface{})
-		for k, v := range data{
-			if k == "action"{
-				newPiece.Action = v.(string)
-			} else if k == "color"{
-				newPiece.Color = int(v.(float64))
-			} else if k == "moved"{
-				newPiece.Moved = v.(bool)
-			} else if k == "initialState"{
-				initialStateParsed := make(map[string][2]float64)
-				initialStateData := v.(map[string]interface{})
-				for state, cmplx := range initialStateData{
-					var cmplxParsed [2]float64
-					cmplxData := cmplx.([]interface{})
-					for i, num := range cmplxData{
-						cmplxParsed[i] = num.(float64)
-					}
-					initialStateParsed[state] = cmplxParsed
-				}
-				newPiece.State = initialStateParsed
-
-			} else if k == "stateSpace"{
-				stateSpaceData := v.([]interface{})
-				var stateSpaceParse = make([]string, 0,0)
-				for _, v := range stateSpaceData{
-					stateSpaceParse = append(stateSpaceParse, v.(string))
-				}
-				newPiece.StateSpace = stateSpaceParse
-				//fmt.Println("stateSpaceData",stateSpaceData)
-			} else if k == "states"{
-				statesParsed := make(map[string][2]float64)
-				statesData := v.(map[string]interface{})
-				for state, cmplx := range statesData{
-					var cmplxParsed [2]float64
-					cmplxData := cmplx.([]interface{})
-					for i, num := range cmplxData{
-						cmplxParsed[i] = num.(float64)
-					}
-					statesParsed[state] = cmplxParsed
-				}
-				newPiece.State = statesParsed
-			}
-		}
-
-		pid,err := strconv.ParseInt(id, 10, 0)
-		if err != nil{
-			log.Println(err)
-		}
-		pieces.List[int(pid)] = newPiece
-	}
-
-
-	for id, interf := range message.Entanglements{
-		newEntanglement := &quantumchess.Entanglement{}
-
-		if interf == nil {
-			newEntanglement = nil
-		} else {
-			data := interf.(map[string]interface{})
-			for attr, value := range data{
-				if attr == "elements"{
-					entangledId := value.([]int)
-					newEntanglement.Elements = entangledId
-				} else if attr == "state"{
-					entangledState := value.([][2]float64)
-					// might have parse it as interface{}
-					newEntanglement.State = entangledState
-				}
+		if channel != nil {
+			select {
+			case channel <- ClientMessage{Client: c, Message: *message}:
+			case <-c.GamePool.done:
+				return
 			}
 		}
 
 
-		pid, err := strconv.ParseInt(id, 10, 0)
-		if err != nil{
-			log.Println(err)
-		}
-		entanglements.List[int(pid)] = newEntanglement
-	}
-
-	if DEBUG_DECODE {
-		for k,v:= range pieces.List{
-			fmt.Println(k,v)
-		}
-
-		for k,v := range entanglements.List{
-			fmt.Println(k,v)
-		}
 	}
 }
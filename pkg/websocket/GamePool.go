@@ -2,7 +2,12 @@ package websocket
 
 import (
 	"fmt"
+	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/quantumchess"
+	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/rating"
+	"log"
 	"math/rand"
+	"sync"
+	"time"
 )
 
 //WHITE int representing the color white in chess
@@ -11,24 +16,23 @@ var WHITE int = 0
 //BLACK int representing color black in chess
 var BLACK int = 1
 
-//GameInfo stores the info that should be sent to users seeking to display a list of gamerooms.
-type GameInfo struct {
-	Ids     []string
-	Players []string
-}
+//SPECTATOR int representing the color of clients watching a game without playing
+var SPECTATOR int = 2
 
-//Rooms represent a struct that manages all games and their privacy.
-type Rooms struct {
-	Privacy map[string]bool //false is public, true is private
-	Games   map[string]*GamePool
-}
+//PREVIEW_RATE_LIMIT is the number of move previews a player can request within PREVIEW_RATE_WINDOW
+var PREVIEW_RATE_LIMIT int = 10
 
-//NewRooms creates a new empty instance of Rooms
-func NewRooms() *Rooms {
-	return &Rooms{
-		Privacy: make(map[string]bool),
-		Games:   make(map[string]*GamePool),
-	}
+//PREVIEW_RATE_WINDOW is the period previews are counted over for rate limiting
+var PREVIEW_RATE_WINDOW time.Duration = 10 * time.Second
+
+//GameInfo stores the info that should be sent to users seeking to display a list of gamerooms.
+type GameInfo struct {
+	Ids          []string
+	Players      []string
+	Setups       []string
+	SetupNumbers []string // seed of Quantum960 setups, empty for other setups
+	Spectators   []string
+	States       []string // waiting, playing or finished
 }
 
 //GamePool manages the communication channels of a specific Game room.
@@ -36,108 +40,540 @@ type GamePool struct {
 	ID         string
 	Register   chan *GameClient
 	Unregister chan *GameClient
-	Clients    map[*GameClient]int // maps to BLACK or WHITE, both cannot be the same obviously
+	Clients    map[*GameClient]int // maps to BLACK, WHITE or SPECTATOR, both players cannot be the same obviously
 	Broadcast  chan GameMessage
-	//Timer channel
-	//Timeout channel
-	//Players [2]string
-	Start bool
-	Over  bool
+	Moves      chan ClientMessage
+	Takebacks  chan ClientMessage // takeback requests and answers, and rematch offers
+	Previews   chan ClientMessage // move preview requests
+	Resyncs    chan *GameClient   // clients that missed a board update and need the whole position
+	Chats      chan ClientMessage // chat messages and mute requests
+	Timeouts   chan int           // colors whose clock may have run out
+	Forfeits   chan int           // colors of disconnected players whose grace period ended
+	Players    [2]string          // ids of the players, indexed by color
+	Start      bool
+	Over       bool
+	Private    bool // private rooms are not listed, and only clients with the invite token can play in them
+	Spectators bool // whether clients without the invite token can watch
+	// Setup is the name of the starting setup, the game below is owned by the pool
+	Setup       string
+	SetupNumber int64 // seed of a Quantum960 setup, -1 for other setups
+	Variant     string
+	TimeControl string // time control the players were matched with, empty for created games
+	Clock       *Clock       // nil for games without a time control
+	Rated       bool         // whether the result of the game updates the ratings of the players
+	Ratings     rating.Store // where the ratings of a rated game are updated
+	Game        *quantumchess.Game
+	Draws       *quantumchess.DrawState // repetitions and move limit of the position
+	Takeback    int                     // color of the player asking for a takeback, -1 if none
+	Seed        int64                   // seed of the random choices of the room: colors and measurements
+	// ColorPreference is the color the Creator takes: white, black or random.
+	ColorPreference string
+	Creator         string  // identity of the user who created the room, empty if unknown
+	Rematches       int     // number of rematches played in the room
+	RematchOffers   [2]bool // whether each player offered a rematch of the finished game, indexed by color
+	Seq         int                     // version of the position sent to clients
+	ChatHistory []ChatEntry
+	ChatFilters []ChatFilter // applied in order to every chat message
+	Muted       [2]bool      // whether each player muted their opponent's chat, indexed by color
+
+	chatTimes       map[*GameClient][]time.Time // recent chat messages of each client, for rate limiting
+	previewTimes    map[*GameClient][]time.Time // recent previews of each client, for rate limiting
+	reconnectTokens [2]string                   // tokens the players can rejoin with, indexed by color
+	graceTimers     [2]*time.Timer              // pending forfeits of disconnected players, indexed by color
+	clockTimer      *time.Timer                 // pending timeout of the running player
+	idleTimer       *time.Timer                 // closes the room when it stays without clients
+
+	info      RoomInfo // snapshot returned by Info
+	infoMutex sync.RWMutex
+	quit      chan struct{} // closed to ask the room to close
+	done      chan struct{} // closed once the room goroutine exited
+	closeOnce sync.Once
+	closed    bool
+	onClose   func()
+	invite    string     // token required to play in a private room
+	rng       *rand.Rand // seeded with Seed
 }
 
-//NewGamePool builds a new game room with the given id.
-func NewGamePool(id string) *GamePool {
-	return &GamePool{
-		ID:         id,
-		Register:   make(chan *GameClient),
-		Unregister: make(chan *GameClient),
-		Clients:    make(map[*GameClient]int),
-		Broadcast:  make(chan GameMessage),
-		Start:      false,
-		Over:       false,
+//NewGamePool builds a new game room with the given id, starting from the named setup.
+// A new Quantum960 position is generated when the setup is "quantum960".
+// Returns an error if the setup is not registered.
+func NewGamePool(id string, setup string) (*GamePool, error) {
+	if setup == quantumchess.QUANTUM960 {
+		setup = fmt.Sprintf("%v-%d", quantumchess.QUANTUM960, newSeed()%1000000)
+	}
+	setupNumber, ok := quantumchess.ParseQuantum960(setup)
+	if !ok {
+		setupNumber = -1
+	}
+	definition, err := quantumchess.GetSetup(setup)
+	if err != nil {
+		return nil, err
+	}
+	seed := newSeed()
+	game, err := quantumchess.NewGame(setup, seed)
+	if err != nil {
+		return nil, err
+	}
+	variant := definition.Variant
+	if variant == "" {
+		variant = "Classic"
 	}
+
+	return &GamePool{
+		ID:          id,
+		Register:    make(chan *GameClient),
+		Unregister:  make(chan *GameClient),
+		Clients:     make(map[*GameClient]int),
+		Broadcast:   make(chan GameMessage),
+		Moves:       make(chan ClientMessage),
+		Takebacks:   make(chan ClientMessage),
+		Previews:    make(chan ClientMessage),
+		Resyncs:     make(chan *GameClient),
+		Chats:       make(chan ClientMessage),
+		Timeouts:    make(chan int),
+		Forfeits:    make(chan int),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+		chatTimes:   make(map[*GameClient][]time.Time),
+		previewTimes: make(map[*GameClient][]time.Time),
+		Start:       false,
+		Over:        false,
+		Setup:       setup,
+		SetupNumber: setupNumber,
+		Variant:     variant,
+		Game:        game,
+		Draws: quantumchess.NewDrawState(game.Board.Hash),
+		Takeback: -1,
+		Seed:     seed,
+		rng:      rand.New(rand.NewSource(seed)),
+	}, nil
 }
 
 //StartGame activates the websocket "listener" to manage the communication channels of the Game room.
+// The room closes when Close is called or when it stays without clients for ROOM_IDLE_TIMEOUT.
 func (pool *GamePool) StartGame() {
+	pool.idleTimer = time.NewTimer(ROOM_IDLE_TIMEOUT)
+	defer pool.shutdown()
 	for {
+		empty := len(pool.Clients) == 0
 		select {
+		case <-pool.quit:
+			return
+
+		case <-pool.idleTimer.C:
+			fmt.Println("Closing idle game", pool.ID)
+			return
+
 		case client := <-pool.Register:
 			connectedId := client.ID
 
 			fmt.Println("Size of Game Connection Pool: ", len(pool.Clients))
 			fmt.Println("ID of client who joined", connectedId)
 
-			if !pool.Start {
+			if pool.Start && pool.reconnect(client) {
+				break
+			}
+			if !pool.canWatch(client) {
+				pool.reject(client, "an invite is required to join this game")
+				break
+			}
+			if !pool.Start && pool.canPlay(client) {
 				assignInitialPlayers(pool, client)
+			} else {
+				pool.addSpectator(client)
 			}
 
-			//send messages on connect:
-
 			break
 		case client := <-pool.Unregister:
+			client.out.close()
+			color, ok := pool.Clients[client]
 			delete(pool.Clients, client)
+			delete(pool.chatTimes, client)
+			delete(pool.previewTimes, client)
 			msg := client.ID
 			fmt.Println(msg)
+			if !ok {
+				// replaced by a reconnection
+				break
+			}
+			if color == SPECTATOR {
+				pool.writeAll(GameMessage{Type: 4, Pid: msg, Message: "leave", Spectators: pool.SpectatorCount()})
+				break
+			}
+			if pool.Start && !pool.Over {
+				pool.disconnect(client, color)
+				break
+			}
 			for client, _ := range pool.Clients {
-				client.Conn.WriteJSON(GameMessage{Type: 3, Pid: msg})
+				client.Send(GameMessage{Type: 3, Pid: msg})
 			}
 			break
 
 		case message := <-pool.Broadcast:
 			fmt.Println("Sending message to all clients in Pool")
-			for client, _ := range pool.Clients {
-				if err := client.Conn.WriteJSON(message); err != nil {
-					fmt.Println(err)
-					return
-				}
+			pool.writeAll(message)
+
+		case message := <-pool.Moves:
+			pool.playMove(message.Client, message.Message)
+
+		case message := <-pool.Takebacks:
+			if message.Message.Type == 12 {
+				pool.offerRematch(message.Client)
+			} else if message.Message.Type == 5 {
+				pool.requestTakeback(message.Client)
+			} else {
+				pool.answerTakeback(message.Client, message.Message.Accept)
+			}
+
+		case message := <-pool.Previews:
+			pool.previewMove(message.Client, message.Message)
+
+		case client := <-pool.Resyncs:
+			client.Send(pool.positionMessage(8))
+
+		case color := <-pool.Timeouts:
+			pool.timeout(color)
+
+		case color := <-pool.Forfeits:
+			pool.forfeit(color)
+
+		case message := <-pool.Chats:
+			if message.Message.Type == 9 {
+				pool.mute(message.Client, message.Message.Mute)
+			} else {
+				pool.chat(message.Client, message.Message.Message)
 			}
 		}
+		if len(pool.Clients) == 0 && !empty {
+			pool.idleTimer.Reset(ROOM_IDLE_TIMEOUT)
+		} else if len(pool.Clients) > 0 && empty && !pool.idleTimer.Stop() {
+			<-pool.idleTimer.C
+		}
+		pool.updateInfo()
 	}
 }
 
-func assignInitialPlayers(pool *GamePool, client *GameClient) {
-	if len(pool.Clients) == 0 {
+//playMove applies the move of a player to the game, and sends the changes of the position to all clients.
+// A move that is not valid is answered with the whole current position.
+func (pool *GamePool) playMove(client *GameClient, message GameMessage) {
+	color, ok := pool.Clients[client]
+	if pool.Over || !ok || color != pool.Game.ToMove {
+		fmt.Println("Ignoring move from", client.ID)
+		client.Send(pool.positionMessage(8))
+		return
+	}
+	now := time.Now()
+	if pool.Clock != nil && pool.Clock.Times(now)[color] <= 0 {
+		pool.timeout(color)
+		return
+	}
+	result, err := pool.Game.Apply(messageMove(message))
+	if err != nil {
+		fmt.Println("Error applying move")
+		log.Println(err)
+		client.Send(pool.positionMessage(8))
+		return
+	}
+	pool.Takeback = -1
+	pool.Seq++
+	if pool.Clock != nil {
+		pool.Clock.Press(now)
+	}
 
-		color := rand.Intn(1)
-		pool.Clients[client] = color
+	fmt.Println("Sending board update to all clients in Pool")
+	reason := pool.endReason(result)
+	if reason != "" {
+		pool.Over = true
+		if pool.Clock != nil {
+			pool.Clock.Stop(now)
+		}
+	}
+	pool.armClock()
+	update := pool.stateMessage(1)
+	update.Delta = pool.Game.LastDelta()
+	update.Events = result.Events
+	update.Reason = reason
+	// only a checkmate has a winner, the other reasons are draws
+	winner := -1
+	if reason == quantumchess.REASON_CHECKMATE {
+		winner = result.Color
+	}
+	if reason != "" {
+		update.GameEnd = true
+		update.Checkmate = winner != -1
+		update.Winner = winner
+	}
+	pool.writeAll(update)
+	if pool.Over {
+		pool.recordResult(winner)
+	}
+}
 
-	} else if len(pool.Clients) == 1 {
-		var otherColor int
+//recordResult updates the ratings of the players of a rated game with its winner, -1 for a draw.
+func (pool *GamePool) recordResult(winner int) {
+	if !pool.Rated || pool.Ratings == nil {
+		return
+	}
+	whiteScore := 0.5
+	if winner == WHITE {
+		whiteScore = 1
+	} else if winner == BLACK {
+		whiteScore = 0
+	}
+	category := rating.Category(pool.TimeControl)
+	if err := rating.RecordGame(pool.Ratings, category, pool.Players[WHITE], pool.Players[BLACK], whiteScore); err != nil {
+		fmt.Println("Unable to record the result of game", pool.ID)
+		log.Println(err)
+	}
+}
 
-		for _, color := range pool.Clients {
-			if color == 1 {
-				otherColor = 0
-			} else {
-				otherColor = 1
+//previewMove answers a preview request with the possible outcomes of its move in the current position.
+// Only the player on move can preview moves, at most PREVIEW_RATE_LIMIT within PREVIEW_RATE_WINDOW.
+func (pool *GamePool) previewMove(client *GameClient, message GameMessage) {
+	response := GameMessage{Type: 7, Move: message.Move, MoveType: message.MoveType, Targets: message.Targets}
+	if color, ok := pool.Clients[client]; !ok || color != pool.Game.ToMove || pool.Over {
+		response.Error = "only the player on move can preview moves"
+		client.Send(response)
+		return
+	}
+	if !allowRate(pool.previewTimes, client, time.Now(), PREVIEW_RATE_LIMIT, PREVIEW_RATE_WINDOW) {
+		response.Error = "too many previews"
+		client.Send(response)
+		return
+	}
+	game := pool.Game
+	preview, err := quantumchess.PreviewMove(game.Board, game.Entanglements, game.Pieces, messageMove(message))
+	if err != nil {
+		response.Message = err.Error()
+	}
+	response.Preview = preview
+	client.Send(response)
+}
+
+//messageMove returns the move described by a message.
+func messageMove(message GameMessage) quantumchess.Move {
+	return quantumchess.Move{Type: message.MoveType, Start: message.Move[0], End: message.Move[1],
+		Targets: message.Targets, Promotion: message.Promotion}
+}
+
+//endReason returns the reason the game ends after a move, "" if it goes on.
+func (pool *GamePool) endReason(result quantumchess.MoveResult) string {
+	game := pool.Game
+	if quantumchess.IsCertainCheckmate(game.Board, game.Pieces, game.ToMove) {
+		return quantumchess.REASON_CHECKMATE
+	}
+	if quantumchess.IsStalemate(game.Board, game.Pieces, game.ToMove) {
+		return quantumchess.REASON_STALEMATE
+	}
+	return pool.Draws.Record(result.Hash, result.Irreversible)
+}
+
+//requestTakeback forwards the takeback request of a player to the opponent.
+// Only the last move of the game can be taken back, by the player who played it.
+func (pool *GamePool) requestTakeback(client *GameClient) {
+	color, ok := pool.Clients[client]
+	if pool.Over || !ok || (color != WHITE && color != BLACK) || !pool.lastMoveBy(color) {
+		client.Send(GameMessage{Type: 6, Accept: false})
+		return
+	}
+	pool.Takeback = color
+	for opponent, opponentColor := range pool.Clients {
+		if opponentColor == 1-color {
+			opponent.Send(GameMessage{Type: 5, Pid: client.ID, Color: color})
+		}
+	}
+}
+
+//answerTakeback applies the answer of the opponent to a pending takeback request.
+// An accepted takeback undoes the requesting player's last move, and sends the restored position to all clients.
+// The request is declined if the game ended since it was made.
+func (pool *GamePool) answerTakeback(client *GameClient, accept bool) {
+	color, ok := pool.Clients[client]
+	if !ok || pool.Takeback == -1 || color != 1-pool.Takeback {
+		return
+	}
+	requester := pool.Takeback
+	pool.Takeback = -1
+	if !accept || pool.Over || !pool.lastMoveBy(requester) {
+		for player, playerColor := range pool.Clients {
+			if playerColor == requester {
+				player.Send(GameMessage{Type: 6, Accept: false})
 			}
 		}
+		return
+	}
+
+	if err := pool.Game.Undo(); err != nil {
+		log.Println(err)
+		return
+	}
+	pool.Draws.Undo()
+	if pool.Clock != nil {
+		pool.Clock.Start(pool.Game.ToMove, time.Now())
+		pool.armClock()
+	}
+	pool.Seq++
+	restored := pool.positionMessage(6)
+	restored.Accept = true
+	pool.writeAll(restored)
+}
+
+//lastMoveBy checks whether the last move of the game was played by the given color.
+func (pool *GamePool) lastMoveBy(color int) bool {
+	history := pool.Game.History
+	return len(history) > 0 && history[len(history)-1].Color == color
+}
+
+//writeAll sends a message to all clients in the pool.
+func (pool *GamePool) writeAll(message GameMessage) {
+	for client, _ := range pool.Clients {
+		client.Send(message)
+	}
+}
+
+//positionMessage builds a message of the given type holding the whole current position of the game.
+func (pool *GamePool) positionMessage(messageType int) GameMessage {
+	game := pool.Game
+	message := pool.stateMessage(messageType)
+	message.Variant = pool.Variant
+	message.Setup = pool.Setup
+	message.NewBoard = game.Board.Positions
+	message.NewPieces = game.Pieces
+	message.NewEntanglements = game.Entanglements
+	message.NewOccupancy = game.Board.Occupancy
+	return message
+}
+
+//stateMessage builds a message of the given type holding the version of the position, the color to move
+// and the check probabilities, without the position itself.
+func (pool *GamePool) stateMessage(messageType int) GameMessage {
+	game := pool.Game
+	message := GameMessage{
+		Type:      messageType,
+		Seq:       pool.Seq,
+		EnPassant: game.Board.EnPassant,
+		ToMove:    game.ToMove,
+		Check: [2]float64{quantumchess.CheckProbability(game.Board, game.Pieces, WHITE),
+			quantumchess.CheckProbability(game.Board, game.Pieces, BLACK)},
+	}
+	if pool.Clock != nil {
+		message.Clock = pool.Clock.Millis(time.Now())
+	}
+	return message
+}
+
+func assignInitialPlayers(pool *GamePool, client *GameClient) {
+	players := len(pool.Clients) - pool.SpectatorCount()
+	if players == 0 {
+
+		// whoever joins first, the creator gets the color they asked for
+		color := pool.creatorColor()
+		if pool.Creator != "" && client.ID != pool.Creator {
+			color = 1 - color
+		}
+		pool.Clients[client] = color
+
+	} else if players == 1 {
+		otherColor := WHITE
+		if pool.player(WHITE) != nil {
+			otherColor = BLACK
+		}
+		if pool.Creator != "" && client.ID != pool.Creator && pool.player(1-otherColor).ID != pool.Creator {
+			// the remaining seat is kept for the creator
+			pool.addSpectator(client)
+			return
+		}
+		if pool.Rated && pool.player(1-otherColor).ID == client.ID {
+			// a rated game cannot be played against oneself, it would only farm rating
+			pool.addSpectator(client)
+			return
+		}
 		pool.Clients[client] = otherColor
 		pool.Start = true
 
 	} else {
-		pool.Clients[client] = 2
+		pool.addSpectator(client)
+		return
 	}
 
 	// NOW SEND MESSAGES WHEN BOTH WHITE AND BLACK PLAYER HAVE CONNECTED
-	var whitePlayer string
-	var blackPlayer string
-	if len(pool.Clients) == 2 {
-		for player, color := range pool.Clients {
-			if color == 0 {
-				whitePlayer = player.ID
-			} else if color == 1 {
-				blackPlayer = player.ID
-			}
+	if pool.Start {
+		pool.startGame()
+	}
+}
+
+//creatorColor returns the color of the creator of the room, following its color preference.
+// Rooms without a creator give it to the first player to join.
+func (pool *GamePool) creatorColor() int {
+	switch pool.ColorPreference {
+	case COLOR_WHITE:
+		return WHITE
+	case COLOR_BLACK:
+		return BLACK
+	default:
+		return pool.rng.Intn(2)
+	}
+}
+
+//startGame starts the game between the connected players: it gives them new reconnect tokens, starts the clock and
+// sends everyone the game start message with both players and the time control.
+func (pool *GamePool) startGame() {
+	whitePlayer := pool.player(WHITE).ID
+	blackPlayer := pool.player(BLACK).ID
+	pool.Players = [2]string{whitePlayer, blackPlayer}
+	pool.reconnectTokens = [2]string{newToken(), newToken()}
+	pool.Clock = nil
+	if pool.TimeControl != "" {
+		clock, err := NewClock(pool.TimeControl)
+		if err != nil {
+			log.Println(err)
+		} else {
+			pool.Clock = clock
+			pool.Clock.Start(WHITE, time.Now())
 		}
-		for client, color := range pool.Clients {
-			if color == 0 {
-				client.Conn.WriteJSON(GameMessage{Type: 0, Pid: blackPlayer, Color: color})
-			} else if color == 1 {
-				client.Conn.WriteJSON(GameMessage{Type: 0, Pid: whitePlayer, Color: color})
-			}
+	}
+	pool.armClock()
+	for client, color := range pool.Clients {
+		start := pool.positionMessage(0)
+		start.GameStart = true
+		start.Color = color
+		start.White = whitePlayer
+		start.Black = blackPlayer
+		start.TimeControl = pool.TimeControl
+		start.Rematch = pool.Rematches
+		if color == WHITE || color == BLACK {
+			start.Pid = pool.Players[1-color]
+			start.Reconnect = pool.reconnectTokens[color]
 		}
+		client.Send(start)
 	}
+}
 
-	//SEND MESSAGES WHEN SPECTATORS JOIN
+//addSpectator adds a client watching the game. The spectator receives the current position,
+// and everyone is told that the spectator joined.
+func (pool *GamePool) addSpectator(client *GameClient) {
+	pool.Clients[client] = SPECTATOR
+	snapshot := pool.positionMessage(4)
+	snapshot.Color = SPECTATOR
+	snapshot.Pid = client.ID
+	snapshot.GameStart = pool.Start
+	snapshot.GameEnd = pool.Over
+	snapshot.Spectators = pool.SpectatorCount()
+	client.Send(snapshot)
+	for other, _ := range pool.Clients {
+		if other != client {
+			other.Send(GameMessage{Type: 4, Pid: client.ID, Message: "join", Spectators: snapshot.Spectators})
+		}
+	}
+}
+
+//SpectatorCount returns the number of clients watching the game.
+func (pool *GamePool) SpectatorCount() int {
+	count := 0
+	for _, color := range pool.Clients {
+		if color == SPECTATOR {
+			count++
+		}
+	}
+	return count
 }
@@ -0,0 +1,120 @@
+package websocket
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/quantumchess"
+)
+
+// queueEntry is a client waiting in a matchmaking queue.
+type queueEntry struct {
+	client *Client
+	rating float64
+	rated  bool
+	joined time.Time
+}
+
+// queueKey returns the id of the queue of a time control and variant.
+func queueKey(timeControl string, variant string) string {
+	return timeControl + "/" + variant
+}
+
+// validVariant checks whether games can be created with the given setup.
+func validVariant(variant string) bool {
+	if variant == quantumchess.QUANTUM960 {
+		return true
+	}
+	_, err := quantumchess.GetSetup(variant)
+	return err == nil
+}
+
+// joinQueue adds a client to the queue of the time control and variant of the message, leaving any queue it was in,
+// then pairs it with a waiting client if there is one.
+func (pool *Pool) joinQueue(client *Client, message Message) {
+	if message.Variant == "" {
+		message.Variant = "standard"
+	}
+	if _, _, err := parseTimeControl(message.TimeControl); err != nil || !validVariant(message.Variant) {
+		client.Send(Message{Type: 1, Error: "invalid time control or variant"})
+		return
+	}
+	pool.leaveQueue(client)
+
+	key := queueKey(message.TimeControl, message.Variant)
+	entry := &queueEntry{client: client, joined: time.Now()}
+	if pool.Rating != nil {
+		entry.rating, entry.rated = pool.Rating(client.ID, message.TimeControl)
+	}
+	opponent := pool.findOpponent(key, entry)
+	if opponent == nil {
+		pool.queues[key] = append(pool.queues[key], entry)
+		client.Send(Message{Type: 1, QueueId: key, TimeControl: message.TimeControl, Variant: message.Variant})
+		return
+	}
+	pool.removeEntry(key, opponent)
+
+	gamePool, err := pool.Rooms.CreateGame(RoomOptions{Private: true, Spectators: true, Setup: message.Variant,
+		TimeControl: message.TimeControl, Rated: true})
+	if err != nil {
+		fmt.Println(err)
+		client.Send(Message{Type: 1, Error: err.Error()})
+		pool.queues[key] = append([]*queueEntry{opponent}, pool.queues[key]...)
+		return
+	}
+	fmt.Println("Matched", opponent.client.ID, "and", client.ID, "in game", gamePool.ID)
+	found := Message{Type: 3, QueueId: key, TimeControl: message.TimeControl, Variant: message.Variant,
+		GameId: gamePool.ID, Invite: gamePool.Invite()}
+	opponent.client.Send(found)
+	client.Send(found)
+}
+
+// findOpponent returns the waiting entry of another user to pair with entry, nil if there is none.
+// When both are rated, it is the rated entry with the closest rating, otherwise the entry that waited the longest.
+func (pool *Pool) findOpponent(key string, entry *queueEntry) *queueEntry {
+	var best *queueEntry
+	for _, waiting := range pool.queues[key] {
+		// the same user can queue from several connections, and must not be matched against themselves
+		if waiting.client == entry.client || waiting.client.ID == entry.client.ID {
+			continue
+		}
+		if best == nil {
+			best = waiting
+			continue
+		}
+		if entry.rated && waiting.rated &&
+			(!best.rated || math.Abs(waiting.rating-entry.rating) < math.Abs(best.rating-entry.rating)) {
+			best = waiting
+		}
+	}
+	return best
+}
+
+// leaveQueue removes a client from every queue it is in.
+func (pool *Pool) leaveQueue(client *Client) {
+	for key, entries := range pool.queues {
+		for _, entry := range entries {
+			if entry.client == client {
+				pool.removeEntry(key, entry)
+				break
+			}
+		}
+	}
+}
+
+// removeEntry removes an entry from the queue with the given key.
+func (pool *Pool) removeEntry(key string, entry *queueEntry) {
+	entries := pool.queues[key]
+	for i, e := range entries {
+		if e == entry {
+			entries = append(entries[:i:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(entries) == 0 {
+		delete(pool.queues, key)
+		return
+	}
+	pool.queues[key] = entries
+}
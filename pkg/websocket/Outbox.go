@@ -0,0 +1,120 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WRITE_WAIT is how long writing a message to a client can take before the connection is dropped
+var WRITE_WAIT time.Duration = 10 * time.Second
+
+// PONG_WAIT is how long a client can stay silent, pongs included, before the connection is dropped
+var PONG_WAIT time.Duration = 60 * time.Second
+
+// PING_PERIOD is how often clients are pinged, it must be shorter than PONG_WAIT
+var PING_PERIOD time.Duration = PONG_WAIT * 9 / 10
+
+// MAX_MESSAGE_SIZE is the maximum size in bytes of a message read from a client
+var MAX_MESSAGE_SIZE int64 = 8192
+
+// SEND_QUEUE_SIZE is the number of messages that can wait to be written to a client.
+// Clients that fall further behind are evicted.
+var SEND_QUEUE_SIZE int = 64
+
+// outbox is the bounded queue of the messages waiting to be written to a connection by its writer goroutine,
+// which also pings the connection every PING_PERIOD.
+// Messages are encoded when they are queued: they often hold maps and slices of the game state, which the room
+// goroutine keeps modifying while the writer goroutine works through the queue.
+type outbox struct {
+	conn   *websocket.Conn
+	queue  chan []byte
+	mutex  sync.Mutex
+	closed bool
+}
+
+// newOutbox creates the outbox of a connection and starts its writer goroutine.
+func newOutbox(conn *websocket.Conn) *outbox {
+	out := &outbox{conn: conn, queue: make(chan []byte, SEND_QUEUE_SIZE)}
+	go out.write(PING_PERIOD)
+	return out
+}
+
+// send encodes a message to JSON and queues it to be written.
+// Returns false if the queue is full or closed, or if the message cannot be encoded.
+func (out *outbox) send(message interface{}) bool {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	if out.closed {
+		return false
+	}
+	select {
+	case out.queue <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops the writer goroutine once the queued messages are written.
+func (out *outbox) close() {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	if !out.closed {
+		out.closed = true
+		close(out.queue)
+	}
+}
+
+// write writes the queued messages, and a ping every period, to the connection until the outbox is closed or
+// a write fails, then closes the connection.
+func (out *outbox) write(period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer func() {
+		ticker.Stop()
+		out.conn.Close()
+	}()
+	for {
+		select {
+		case data, ok := <-out.queue:
+			out.conn.SetWriteDeadline(time.Now().Add(WRITE_WAIT))
+			if !ok {
+				out.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := out.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Println(err)
+				return
+			}
+		case <-ticker.C:
+			out.conn.SetWriteDeadline(time.Now().Add(WRITE_WAIT))
+			if err := out.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Println(err)
+				return
+			}
+		}
+	}
+}
+
+// prepareRead limits the size of the messages read from a connection, and drops it if no message or pong
+// is received for PONG_WAIT.
+func prepareRead(conn *websocket.Conn) {
+	conn.SetReadLimit(MAX_MESSAGE_SIZE)
+	conn.SetReadDeadline(time.Now().Add(PONG_WAIT))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(PONG_WAIT))
+	})
+}
+
+// extendRead gives a connection PONG_WAIT more to send its next message.
+func extendRead(conn *websocket.Conn) {
+	conn.SetReadDeadline(time.Now().Add(PONG_WAIT))
+}
@@ -11,6 +11,13 @@ type Pool struct {
 	Unregister chan *Client
 	Clients    map[*Client]int
 	Broadcast  chan Message
+	Queue      chan LobbyMessage
+	// Rooms are where matched games are created.
+	Rooms *Rooms
+	// Rating returns the rating of a player for a time control, false if it is unknown. Players are paired in
+	// order of arrival when nil.
+	Rating func(id string, timeControl string) (float64, bool)
+	queues map[string][]*queueEntry
 }
 
 //NewPool creates an empty instance of a pool
@@ -20,6 +27,8 @@ func NewPool() *Pool {
 		Unregister: make(chan *Client),
 		Clients:    make(map[*Client]int),
 		Broadcast:  make(chan Message),
+		Queue:      make(chan LobbyMessage),
+		queues:     make(map[string][]*queueEntry),
 	}
 }
 
@@ -29,29 +38,34 @@ func (pool *Pool) Start() {
 		select {
 		case client := <-pool.Register:
 			pool.Clients[client] = 0
-			fmt.Println("Size of Connection Pool: ", len(pool.Clients), "\n")
+			fmt.Println("Size of Connection Pool: ", len(pool.Clients))
 			for client := range pool.Clients {
 				msg := strconv.Itoa(len(pool.Clients))
 				fmt.Println(msg)
-				client.Conn.WriteJSON(Message{Type: 0, Players: msg})
+				client.Send(Message{Type: 0, Players: msg})
 			}
 			break
 		case client := <-pool.Unregister:
+			client.out.close()
+			pool.leaveQueue(client)
 			delete(pool.Clients, client)
-			fmt.Println("Size of Connection Pool: ", len(pool.Clients), "\n")
+			fmt.Println("Size of Connection Pool: ", len(pool.Clients))
 			for client := range pool.Clients {
 				msg := strconv.Itoa(len(pool.Clients))
 				fmt.Println(msg)
-				client.Conn.WriteJSON(Message{Type: 0, Players: msg})
+				client.Send(Message{Type: 0, Players: msg})
 			}
 			break
+		case message := <-pool.Queue:
+			if message.Message.Type == 1 {
+				pool.joinQueue(message.Client, message.Message)
+			} else {
+				pool.leaveQueue(message.Client)
+			}
 		case message := <-pool.Broadcast:
 			fmt.Println("Sending message to all clients in Pool")
 			for client := range pool.Clients {
-				if err := client.Conn.WriteJSON(message); err != nil {
-					fmt.Println(err)
-					return
-				}
+				client.Send(message)
 			}
 		}
 	}
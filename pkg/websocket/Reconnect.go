@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"time"
+)
+
+// RECONNECT_GRACE is how long a disconnected player has to rejoin a game in progress before forfeiting it
+var RECONNECT_GRACE time.Duration = 60 * time.Second
+
+// REASON_TIMEOUT and REASON_ABANDONED are why a game ends when a player runs out of time or does not rejoin in time
+var (
+	REASON_TIMEOUT   string = "timeout"
+	REASON_ABANDONED string = "abandoned"
+)
+
+// player returns the connected client playing the given color, nil if that player is disconnected.
+func (pool *GamePool) player(color int) *GameClient {
+	for client, clientColor := range pool.Clients {
+		if clientColor == color {
+			return client
+		}
+	}
+	return nil
+}
+
+// reconnect gives a client back the color whose reconnect token it presented, along with the current position
+// and clock, and tells the other clients. A token is bound to its player: a client of another user presenting it is
+// rejected. Returns false if the client has no valid token.
+func (pool *GamePool) reconnect(client *GameClient) bool {
+	color := -1
+	for c, token := range pool.reconnectTokens {
+		if token != "" && client.Reconnect == token {
+			color = c
+		}
+	}
+	if color < 0 {
+		return false
+	}
+	if client.ID != pool.Players[color] {
+		pool.reject(client, "this reconnect token belongs to another player")
+		return true
+	}
+	// a connection that did not notice it dropped is replaced
+	if previous := pool.player(color); previous != nil {
+		delete(pool.Clients, previous)
+		previous.Conn.Close()
+	}
+	if pool.graceTimers[color] != nil {
+		pool.graceTimers[color].Stop()
+		pool.graceTimers[color] = nil
+	}
+	pool.Clients[client] = color
+
+	position := pool.positionMessage(10)
+	position.Color = color
+	position.Pid = pool.Players[1-color]
+	position.GameStart = true
+	position.GameEnd = pool.Over
+	position.Reconnect = pool.reconnectTokens[color]
+	client.Send(position)
+	for other := range pool.Clients {
+		if other != client {
+			other.Send(GameMessage{Type: 10, Pid: client.ID, Color: color})
+		}
+	}
+	return true
+}
+
+// disconnect tells the other clients that a player of a game in progress left, and gives them RECONNECT_GRACE
+// to rejoin before they forfeit.
+func (pool *GamePool) disconnect(client *GameClient, color int) {
+	for other := range pool.Clients {
+		other.Send(GameMessage{Type: 3, Pid: client.ID, Color: color, Grace: int(RECONNECT_GRACE.Seconds())})
+	}
+	if pool.graceTimers[color] != nil {
+		pool.graceTimers[color].Stop()
+	}
+	pool.graceTimers[color] = time.AfterFunc(RECONNECT_GRACE, func() {
+		select {
+		case pool.Forfeits <- color:
+		case <-pool.done:
+		}
+	})
+}
+
+// forfeit ends the game in favor of the opponent of a player who did not rejoin in time.
+func (pool *GamePool) forfeit(color int) {
+	if pool.Over || pool.player(color) != nil {
+		return
+	}
+	pool.graceTimers[color] = nil
+	pool.endGame(1-color, REASON_ABANDONED)
+}
+
+// timeout ends the game in favor of the opponent of a player whose time ran out.
+// Timeouts of a clock that was pressed since it was armed are ignored.
+func (pool *GamePool) timeout(color int) {
+	clock := pool.Clock
+	if pool.Over || clock == nil || clock.Running != color || clock.Times(time.Now())[color] > 0 {
+		return
+	}
+	pool.endGame(1-color, REASON_TIMEOUT)
+}
+
+// armClock schedules a timeout for when the running player runs out of time, replacing the previous one.
+func (pool *GamePool) armClock() {
+	if pool.clockTimer != nil {
+		pool.clockTimer.Stop()
+		pool.clockTimer = nil
+	}
+	clock := pool.Clock
+	if clock == nil || clock.Running < 0 || pool.Over {
+		return
+	}
+	color := clock.Running
+	pool.clockTimer = time.AfterFunc(clock.Times(time.Now())[color], func() {
+		select {
+		case pool.Timeouts <- color:
+		case <-pool.done:
+		}
+	})
+}
+
+// endGame ends the game without a move, stopping the clock, and tells all clients the winner and the reason.
+func (pool *GamePool) endGame(winner int, reason string) {
+	pool.Over = true
+	if pool.Clock != nil {
+		pool.Clock.Stop(time.Now())
+	}
+	pool.armClock()
+	for color, timer := range pool.graceTimers {
+		if timer != nil {
+			timer.Stop()
+			pool.graceTimers[color] = nil
+		}
+	}
+	end := pool.stateMessage(11)
+	end.GameEnd = true
+	end.Winner = winner
+	end.Reason = reason
+	pool.writeAll(end)
+	pool.recordResult(winner)
+}
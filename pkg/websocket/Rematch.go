@@ -0,0 +1,62 @@
+package websocket
+
+import (
+	"errors"
+	"log"
+
+	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/quantumchess"
+)
+
+// Color preferences of the creator of a room.
+var (
+	COLOR_WHITE  string = "white"
+	COLOR_BLACK  string = "black"
+	COLOR_RANDOM string = "random"
+)
+
+// ErrInvalidColor is returned for color preferences other than white, black or random.
+var ErrInvalidColor = errors.New("colors are white, black or random")
+
+// validColor checks whether a color preference is white, black, random or empty for random.
+func validColor(color string) bool {
+	return color == "" || color == COLOR_WHITE || color == COLOR_BLACK || color == COLOR_RANDOM
+}
+
+// offerRematch records the rematch offer of a player of a finished game and forwards it to the opponent.
+// The rematch starts once both players offered it.
+func (pool *GamePool) offerRematch(client *GameClient) {
+	color, ok := pool.Clients[client]
+	if !pool.Over || !ok || (color != WHITE && color != BLACK) {
+		client.Send(GameMessage{Type: 12, Error: "no finished game to rematch"})
+		return
+	}
+	pool.RematchOffers[color] = true
+	if opponent := pool.player(1 - color); opponent != nil && !pool.RematchOffers[1-color] {
+		opponent.Send(GameMessage{Type: 12, Pid: client.ID, Color: color})
+	}
+	if pool.RematchOffers[WHITE] && pool.RematchOffers[BLACK] && pool.player(1-color) != nil {
+		pool.rematch()
+	}
+}
+
+// rematch starts a new game from the setup of the room between the same players, with their colors swapped.
+func (pool *GamePool) rematch() {
+	game, err := quantumchess.NewGame(pool.Setup, pool.rng.Int63())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	pool.Game = game
+	pool.Draws = quantumchess.NewDrawState(game.Board.Hash)
+	pool.Over = false
+	pool.Takeback = -1
+	pool.RematchOffers = [2]bool{}
+	pool.Rematches++
+	pool.Seq++
+	for client, color := range pool.Clients {
+		if color == WHITE || color == BLACK {
+			pool.Clients[client] = 1 - color
+		}
+	}
+	pool.startGame()
+}
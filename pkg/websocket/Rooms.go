@@ -0,0 +1,271 @@
+package websocket
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/rating"
+)
+
+// States of a game room.
+var (
+	ROOM_WAITING   string = "waiting"   // waiting for both players to join
+	ROOM_PLAYING   string = "playing"   // the game is in progress
+	ROOM_FINISHED  string = "finished"  // the game ended
+	ROOM_ABANDONED string = "abandoned" // the room closed before the game ended
+)
+
+// ROOM_IDLE_TIMEOUT is how long a room can stay without clients before it is closed
+var ROOM_IDLE_TIMEOUT time.Duration = 10 * time.Minute
+
+// ROOM_RETENTION is how long a closed room stays listed, with its final state, before it is removed
+var ROOM_RETENTION time.Duration = 5 * time.Minute
+
+// ErrNoRoomCode is returned when no unused room code could be generated.
+var ErrNoRoomCode = errors.New("no room code available")
+
+// ROOM_CODE_ATTEMPTS is the number of codes tried when creating a room before giving up
+var ROOM_CODE_ATTEMPTS int = 100
+
+// RoomOptions are the settings a game room is created with.
+type RoomOptions struct {
+	Private     bool   // private rooms are not listed, and only clients with their invite token can play in them
+	Spectators  bool   // whether clients without the invite token can watch a private room
+	Setup       string // name of the starting setup, "quantum960" for a random Quantum960 setup
+	TimeControl string // "minutes+increment", empty for games without a clock
+	Rated       bool   // whether the result updates the ratings of the players
+	Color       string // color of the Creator: white, black or random, the default
+	Creator     string // identity of the user creating the room, the first player to join if empty
+}
+
+// RoomInfo is a snapshot of a game room, safe to read from any goroutine.
+type RoomInfo struct {
+	ID          string `json:"id"`
+	State       string `json:"state"`
+	Private     bool   `json:"private"`
+	Spectators  bool   `json:"spectators"` // whether anyone can watch, always true for public rooms
+	Players     int    `json:"players"`
+	Watching    int    `json:"watching"` // number of spectators
+	Setup       string `json:"setup"`
+	SetupNumber int64  `json:"setupNumber"` // seed of a Quantum960 setup, -1 for other setups
+	Variant     string `json:"variant"`
+	TimeControl string `json:"timeControl,omitempty"`
+	Rated       bool   `json:"rated"`
+}
+
+// Rooms manages all game rooms. It is safe for concurrent use.
+// Closed rooms stay listed for ROOM_RETENTION, so that clients can see how they ended, then remove themselves.
+type Rooms struct {
+	Ratings rating.Store // ratings updated by rated games, none are updated when nil
+
+	mutex sync.RWMutex
+	games map[string]*GamePool
+}
+
+// NewRooms creates a new empty instance of Rooms
+func NewRooms() *Rooms {
+	return &Rooms{games: make(map[string]*GamePool)}
+}
+
+// CreateGame creates and starts a game room with the given options, under a new room code.
+// Private rooms get an invite token, returned by Invite.
+// Returns an error if the setup is not registered or the time control is not valid.
+func (rooms *Rooms) CreateGame(options RoomOptions) (*GamePool, error) {
+	if options.TimeControl != "" {
+		if _, _, err := parseTimeControl(options.TimeControl); err != nil {
+			return nil, err
+		}
+	}
+	if !validColor(options.Color) {
+		return nil, ErrInvalidColor
+	}
+	rooms.mutex.Lock()
+	defer rooms.mutex.Unlock()
+	id := ""
+	for i := 0; i < ROOM_CODE_ATTEMPTS && id == ""; i++ {
+		if code := newRoomCode(); rooms.games[code] == nil {
+			id = code
+		}
+	}
+	if id == "" {
+		return nil, ErrNoRoomCode
+	}
+	gamePool, err := NewGamePool(id, options.Setup)
+	if err != nil {
+		return nil, err
+	}
+	gamePool.Private = options.Private
+	gamePool.Spectators = !options.Private || options.Spectators
+	if options.Private {
+		gamePool.invite = newToken()
+	}
+	gamePool.TimeControl = options.TimeControl
+	gamePool.Rated = options.Rated
+	gamePool.ColorPreference = options.Color
+	gamePool.Creator = options.Creator
+	gamePool.Ratings = rooms.Ratings
+	retention := ROOM_RETENTION
+	gamePool.onClose = func() {
+		time.AfterFunc(retention, func() {
+			rooms.remove(id, gamePool)
+		})
+	}
+	gamePool.updateInfo()
+	rooms.games[id] = gamePool
+	go gamePool.StartGame()
+	return gamePool, nil
+}
+
+// Get returns the room with the given code, ignoring case. Closed rooms are returned until they are removed.
+func (rooms *Rooms) Get(id string) (*GamePool, bool) {
+	rooms.mutex.RLock()
+	defer rooms.mutex.RUnlock()
+	gamePool, ok := rooms.games[normalizeRoomCode(id)]
+	return gamePool, ok
+}
+
+// List returns the snapshots of the rooms sorted by id, private ones only if private is set.
+func (rooms *Rooms) List(private bool) []RoomInfo {
+	rooms.mutex.RLock()
+	infos := make([]RoomInfo, 0, len(rooms.games))
+	for _, gamePool := range rooms.games {
+		if info := gamePool.Info(); private || !info.Private {
+			infos = append(infos, info)
+		}
+	}
+	rooms.mutex.RUnlock()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// Shutdown closes and removes every room, disconnecting their clients.
+func (rooms *Rooms) Shutdown() {
+	rooms.mutex.RLock()
+	pools := make([]*GamePool, 0, len(rooms.games))
+	for _, gamePool := range rooms.games {
+		pools = append(pools, gamePool)
+	}
+	rooms.mutex.RUnlock()
+	for _, gamePool := range pools {
+		gamePool.Close()
+		<-gamePool.done
+		rooms.remove(gamePool.ID, gamePool)
+	}
+}
+
+// remove removes a closed room, unless its id was reused.
+func (rooms *Rooms) remove(id string, gamePool *GamePool) {
+	rooms.mutex.Lock()
+	defer rooms.mutex.Unlock()
+	if rooms.games[id] == gamePool {
+		delete(rooms.games, id)
+	}
+}
+
+// Info returns a snapshot of the room.
+func (pool *GamePool) Info() RoomInfo {
+	pool.infoMutex.RLock()
+	defer pool.infoMutex.RUnlock()
+	return pool.info
+}
+
+// updateInfo updates the snapshot of the room returned by Info.
+func (pool *GamePool) updateInfo() {
+	spectators := pool.SpectatorCount()
+	info := RoomInfo{
+		ID:          pool.ID,
+		State:       pool.state(),
+		Private:     pool.Private,
+		Spectators:  pool.Spectators,
+		Players:     len(pool.Clients) - spectators,
+		Watching:    spectators,
+		Setup:       pool.Setup,
+		SetupNumber: pool.SetupNumber,
+		Variant:     pool.Variant,
+		TimeControl: pool.TimeControl,
+		Rated:       pool.Rated,
+	}
+	pool.infoMutex.Lock()
+	pool.info = info
+	pool.infoMutex.Unlock()
+}
+
+// state returns the state of the room.
+func (pool *GamePool) state() string {
+	switch {
+	case pool.closed && !pool.Over:
+		return ROOM_ABANDONED
+	case pool.Over:
+		return ROOM_FINISHED
+	case pool.Start:
+		return ROOM_PLAYING
+	default:
+		return ROOM_WAITING
+	}
+}
+
+// Invite returns the token required to play in a private room, "" for public rooms.
+func (pool *GamePool) Invite() string {
+	return pool.invite
+}
+
+// canPlay checks whether a client may take a color in the room: private rooms require their invite token.
+func (pool *GamePool) canPlay(client *GameClient) bool {
+	return !pool.Private || client.Invite == pool.invite
+}
+
+// canWatch checks whether a client may watch the room.
+func (pool *GamePool) canWatch(client *GameClient) bool {
+	return pool.Spectators || pool.canPlay(client)
+}
+
+// reject tells a client why it cannot join the room and disconnects it.
+func (pool *GamePool) reject(client *GameClient, reason string) {
+	client.Send(GameMessage{Type: 0, Error: reason})
+	client.out.close()
+}
+
+// Join registers a client to the room. Returns false if the room is closed.
+func (pool *GamePool) Join(client *GameClient) bool {
+	select {
+	case pool.Register <- client:
+		return true
+	case <-pool.done:
+		return false
+	}
+}
+
+// Close asks the room to close: its clients are disconnected and its goroutine exits.
+func (pool *GamePool) Close() {
+	pool.closeOnce.Do(func() {
+		close(pool.quit)
+	})
+}
+
+// shutdown stops the timers of the room, disconnects its clients and schedules its removal from its Rooms.
+// It is called by the room goroutine as it exits.
+func (pool *GamePool) shutdown() {
+	pool.closed = true
+	pool.idleTimer.Stop()
+	if pool.clockTimer != nil {
+		pool.clockTimer.Stop()
+	}
+	for _, timer := range pool.graceTimers {
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+	for client := range pool.Clients {
+		client.out.close()
+		delete(pool.Clients, client)
+	}
+	pool.updateInfo()
+	close(pool.done)
+	if pool.onClose != nil {
+		pool.onClose()
+	}
+}
@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"errors"
 	"log"
 	"net/http"
 
@@ -13,13 +14,33 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin:     func(r *http.Request) bool { return true },
 }
 
-//Upgrade turns a regular http Poll into a bi-directional websocket connection
-func Upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+//Authenticate returns the name of the user making a websocket request, or an error if it is not authenticated.
+// Every request is rejected when it is nil.
+var Authenticate func(r *http.Request) (string, error)
+
+//ErrUnauthenticated is returned by Upgrade when no user could be authenticated.
+var ErrUnauthenticated = errors.New("authentication required")
+
+//Upgrade turns a regular http Poll into a bi-directional websocket connection, returning the authenticated user.
+// Unauthenticated requests are answered with 401 Unauthorized and not upgraded.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, string, error) {
+	user, err := "", ErrUnauthenticated
+	if Authenticate != nil {
+		user, err = Authenticate(r)
+	}
+	if err == nil && user == "" {
+		err = ErrUnauthenticated
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, "", err
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
-		return nil, err
+		return nil, "", err
 	}
 
-	return conn, nil
+	return conn, user, nil
 }
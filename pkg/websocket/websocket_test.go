@@ -0,0 +1,875 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandreLamarre/Quantum-Chess-Backend/pkg/quantumchess"
+	"github.com/gorilla/websocket"
+)
+
+// testConn returns both ends of a websocket connection: the server end, as handed to clients by Upgrade,
+// and the remote end, as held by the browser.
+func testConn(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(server.Close)
+	remote, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { remote.Close() })
+	return <-accepted, remote
+}
+
+// drain reads the messages of a connection until it closes, and closes the returned channel then.
+func drain(conn *websocket.Conn) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// listener collects the messages received by the remote end of a connection.
+type listener struct {
+	messages chan []byte
+	closed   chan struct{}
+}
+
+// listen reads the messages of a remote connection until it closes.
+func listen(conn *websocket.Conn) *listener {
+	l := &listener{messages: make(chan []byte, 256), closed: make(chan struct{})}
+	go func() {
+		defer close(l.closed)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			l.messages <- data
+		}
+	}()
+	return l
+}
+
+// receive returns the next message received, failing if none arrives within a second.
+func (l *listener) receive(t *testing.T) []byte {
+	t.Helper()
+	select {
+	case data := <-l.messages:
+		return data
+	case <-l.closed:
+		select {
+		case data := <-l.messages:
+			return data
+		default:
+			t.Fatal("connection closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+	return nil
+}
+
+// game returns the next game message of the given type received, skipping the others.
+func (l *listener) game(t *testing.T, messageType int) GameMessage {
+	t.Helper()
+	for {
+		var message GameMessage
+		if err := json.Unmarshal(l.receive(t), &message); err != nil {
+			t.Fatal(err)
+		}
+		if message.Type == messageType {
+			return message
+		}
+	}
+}
+
+// lobby returns the next lobby message of the given type received, skipping the others.
+func (l *listener) lobby(t *testing.T, messageType int) Message {
+	t.Helper()
+	for {
+		var message Message
+		if err := json.Unmarshal(l.receive(t), &message); err != nil {
+			t.Fatal(err)
+		}
+		if message.Type == messageType {
+			return message
+		}
+	}
+}
+
+// waitClosed fails if the connection is not closed within a second.
+func (l *listener) waitClosed(t *testing.T) {
+	t.Helper()
+	select {
+	case <-l.closed:
+	case <-time.After(time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+// gameClient creates a client of a game room, and listens to what it receives.
+func gameClient(t *testing.T, id string, pool *GamePool) (*GameClient, *listener) {
+	t.Helper()
+	conn, remote := testConn(t)
+	return NewGameClient(id, conn, pool), listen(remote)
+}
+
+// closeClients stops the writer goroutines of the clients of a room that is not running.
+func closeClients(pool *GamePool) {
+	for client := range pool.Clients {
+		client.out.close()
+	}
+}
+
+// eventually fails if condition does not hold within a second. Used to wait for the snapshots of running rooms.
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestSendThenMove checks that a message sent to a client does not share the game state the next move modifies.
+// Run with -race.
+func TestSendThenMove(t *testing.T) {
+	quantumchess.DEBUGAPPLYMOVE = false
+	pool, err := NewGamePool("RACE", "standard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, remote := testConn(t)
+	client := NewGameClient("alice", conn, pool)
+	done := drain(remote)
+
+	// the knights go out and come back
+	moves := []quantumchess.Move{{Start: 62, End: 45}, {Start: 1, End: 18}, {Start: 45, End: 62}, {Start: 18, End: 1}}
+	for i := 0; i < 4*len(moves); i++ {
+		client.Send(pool.positionMessage(8))
+		if _, err := pool.Game.Apply(moves[i%len(moves)]); err != nil {
+			t.Fatal(err)
+		}
+		update := pool.stateMessage(1)
+		update.Delta = pool.Game.LastDelta()
+		client.Send(update)
+	}
+	client.out.close()
+	<-done
+}
+
+// TestTakeback checks that a takeback undoes the last move of the player asking for it, once the opponent accepts.
+func TestTakeback(t *testing.T) {
+	quantumchess.DEBUGAPPLYMOVE = false
+	pool, err := NewGamePool("TAKEBACK", "standard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeClients(pool)
+	pool.ColorPreference = COLOR_WHITE
+	pool.Creator = "alice"
+	alice, aliceRemote := gameClient(t, "alice", pool)
+	bob, bobRemote := gameClient(t, "bob", pool)
+	assignInitialPlayers(pool, alice)
+	assignInitialPlayers(pool, bob)
+	knight := GameMessage{Type: 1, Move: [2]int{62, 45}}
+
+	pool.requestTakeback(alice)
+	if answer := aliceRemote.game(t, 6); answer.Accept {
+		t.Errorf("expected no takeback before the first move")
+	}
+	pool.playMove(alice, knight)
+	pool.requestTakeback(bob)
+	if answer := bobRemote.game(t, 6); answer.Accept {
+		t.Errorf("expected bob not to take back the move of alice")
+	}
+
+	pool.requestTakeback(alice)
+	if request := bobRemote.game(t, 5); request.Pid != "alice" || request.Color != WHITE {
+		t.Errorf("expected bob to be asked for a takeback by alice, got %+v", request)
+	}
+	pool.answerTakeback(alice, true)
+	pool.answerTakeback(bob, false)
+	if answer := aliceRemote.game(t, 6); answer.Accept || len(pool.Game.History) != 1 {
+		t.Errorf("expected only bob to answer, and his refusal to keep the move, got %+v", answer)
+	}
+
+	pool.requestTakeback(alice)
+	pool.answerTakeback(bob, true)
+	if restored := aliceRemote.game(t, 6); !restored.Accept || restored.ToMove != WHITE || restored.NewBoard == nil {
+		t.Errorf("expected the position before the move to be sent, got %+v", restored)
+	}
+	if len(pool.Game.History) != 0 {
+		t.Errorf("expected the move to be taken back, got %v moves", len(pool.Game.History))
+	}
+
+	pool.playMove(alice, knight)
+	pool.requestTakeback(alice)
+	pool.Over = true
+	pool.answerTakeback(bob, true)
+	if answer := aliceRemote.game(t, 6); answer.Accept || len(pool.Game.History) != 1 {
+		t.Errorf("expected no takeback once the game is over, got %+v", answer)
+	}
+}
+
+// TestSpectators checks that spectators get the position when they join, cannot move, and that everyone is told
+// the number of spectators when they join and leave.
+func TestSpectators(t *testing.T) {
+	rooms := NewRooms()
+	defer rooms.Shutdown()
+	game, err := rooms.CreateGame(RoomOptions{Setup: "standard"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, aliceRemote := gameClient(t, "alice", game)
+	bob, _ := gameClient(t, "bob", game)
+	carol, carolRemote := gameClient(t, "carol", game)
+	game.Join(alice)
+	game.Join(bob)
+	aliceRemote.game(t, 0)
+
+	game.Join(carol)
+	snapshot := carolRemote.game(t, 4)
+	if snapshot.Color != SPECTATOR || !snapshot.GameStart || snapshot.NewBoard == nil || snapshot.Spectators != 1 {
+		t.Errorf("expected carol to watch the game from its position, got %+v", snapshot)
+	}
+	if joined := aliceRemote.game(t, 4); joined.Pid != "carol" || joined.Message != "join" || joined.Spectators != 1 {
+		t.Errorf("expected alice to be told carol watches, got %+v", joined)
+	}
+	eventually(t, "carol to watch", func() bool {
+		info := game.Info()
+		return info.Players == 2 && info.Watching == 1
+	})
+
+	game.Moves <- ClientMessage{Client: carol, Message: GameMessage{Type: 1, Move: [2]int{52, 36}}}
+	if resync := carolRemote.game(t, 8); resync.Seq != snapshot.Seq {
+		t.Errorf("expected the move of a spectator to be ignored, got %+v", resync)
+	}
+
+	game.Unregister <- carol
+	if left := aliceRemote.game(t, 4); left.Pid != "carol" || left.Message != "leave" || left.Spectators != 0 {
+		t.Errorf("expected alice to be told carol left, got %+v", left)
+	}
+}
+
+// TestWordFilter checks the words masked by a WordFilter.
+func TestWordFilter(t *testing.T) {
+	for _, test := range []struct {
+		words    []string
+		text     string
+		expected string
+	}{
+		{[]string{"darn"}, "Darn it", "**** it"},
+		{[]string{"darn", ""}, "darned darn", "****ed ****"},
+		{[]string{"ça"}, "Ça va", "** va"},
+		{[]string{"a.b"}, "axb a.b", "axb ***"},
+		{nil, "darn", "darn"},
+	} {
+		if text, ok := NewWordFilter(test.words...).Filter("alice", test.text); !ok || text != test.expected {
+			t.Errorf("expected %v filtering %q to give %q, got %q", test.words, test.text, test.expected, text)
+		}
+	}
+}
+
+// TestAllowRate checks the rate limiting of chat messages and previews.
+func TestAllowRate(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		sent     []time.Duration // times of the requests
+		expected []bool
+	}{
+		{"within the limit", []time.Duration{0, time.Second}, []bool{true, true}},
+		{"over the limit", []time.Duration{0, time.Second, 2 * time.Second}, []bool{true, true, false}},
+		{"after the window", []time.Duration{0, time.Second, 2 * time.Second, 10 * time.Second},
+			[]bool{true, true, false, true}},
+	} {
+		times := make(map[*GameClient][]time.Time)
+		client := &GameClient{ID: "alice"}
+		start := time.Now()
+		for i, sent := range test.sent {
+			if allowed := allowRate(times, client, start.Add(sent), 2, 10*time.Second); allowed != test.expected[i] {
+				t.Errorf("%v: expected request %d allowed to be %v", test.name, i, test.expected[i])
+			}
+		}
+	}
+}
+
+// TestChat checks the channels, mutes, filters and limits of the chat.
+func TestChat(t *testing.T) {
+	pool, err := NewGamePool("CHAT", "standard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeClients(pool)
+	pool.ChatFilters = []ChatFilter{NewWordFilter("darn")}
+	alice, aliceRemote := gameClient(t, "alice", pool)
+	bob, bobRemote := gameClient(t, "bob", pool)
+	carol, carolRemote := gameClient(t, "carol", pool)
+	for _, client := range []*GameClient{alice, bob, carol} {
+		assignInitialPlayers(pool, client)
+	}
+
+	pool.chat(bob, "Darn it")
+	if message := aliceRemote.game(t, 2); message.Message != "**** it" || message.Channel != PLAYERS_CHANNEL {
+		t.Errorf("expected a filtered message on the players channel, got %+v", message)
+	}
+	if message := carolRemote.game(t, 2); message.Message != "**** it" {
+		t.Errorf("expected spectators to read the players channel, got %+v", message)
+	}
+
+	pool.mute(alice, true)
+	if message := aliceRemote.game(t, 9); !message.Mute {
+		t.Errorf("expected alice to be told bob is muted")
+	}
+	pool.chat(bob, "muted")
+	pool.mute(alice, false)
+	pool.chat(bob, "unmuted")
+	if message := aliceRemote.game(t, 2); message.Message != "unmuted" {
+		t.Errorf("expected alice not to receive the messages of bob while he is muted, got %+v", message)
+	}
+	if message := carolRemote.game(t, 2); message.Message != "muted" {
+		t.Errorf("expected spectators to ignore mutes, got %+v", message)
+	}
+
+	pool.chat(carol, "spectating")
+	pool.chat(alice, "players only")
+	if message := aliceRemote.game(t, 2); message.Message != "players only" {
+		t.Errorf("expected players not to read the spectators channel, got %+v", message)
+	}
+	if entry := pool.ChatHistory[len(pool.ChatHistory)-2]; entry.Channel != SPECTATORS_CHANNEL {
+		t.Errorf("expected spectators to write to their channel, got %+v", entry)
+	}
+
+	pool.chat(alice, strings.Repeat("a", CHAT_MAX_LENGTH+1))
+	if message := aliceRemote.game(t, 2); message.Error != "message too long" {
+		t.Errorf("expected a message too long to be rejected, got %+v", message)
+	}
+	for i := 0; i < CHAT_RATE_LIMIT; i++ {
+		pool.chat(bob, "spam")
+	}
+	message := bobRemote.game(t, 2)
+	for message.Error == "" {
+		message = bobRemote.game(t, 2)
+	}
+	if message.Error != "too many messages" {
+		t.Errorf("expected bob to be rate limited, got %+v", message)
+	}
+}
+
+// TestFindOpponent checks which waiting client a client joining a queue is paired with.
+func TestFindOpponent(t *testing.T) {
+	start := time.Now()
+	alice := &queueEntry{client: &Client{ID: "alice"}, joined: start}
+	bob := &queueEntry{client: &Client{ID: "bob"}, rating: 1500, rated: true, joined: start.Add(time.Second)}
+	carol := &queueEntry{client: &Client{ID: "carol"}, rating: 1900, rated: true, joined: start.Add(2 * time.Second)}
+	dave := &Client{ID: "dave"}
+
+	for _, test := range []struct {
+		name     string
+		queue    []*queueEntry
+		entry    *queueEntry
+		expected *queueEntry
+	}{
+		{"empty queue", nil, &queueEntry{client: dave}, nil},
+		{"unrated", []*queueEntry{alice, bob, carol}, &queueEntry{client: dave}, alice},
+		{"closest rating above", []*queueEntry{alice, bob, carol}, &queueEntry{client: dave, rating: 1800, rated: true},
+			carol},
+		{"closest rating below", []*queueEntry{alice, bob, carol}, &queueEntry{client: dave, rating: 1600, rated: true},
+			bob},
+		{"only unrated waiting", []*queueEntry{alice}, &queueEntry{client: dave, rating: 1600, rated: true}, alice},
+		{"already waiting", []*queueEntry{carol}, &queueEntry{client: carol.client, rated: true}, nil},
+		{"same user from another connection", []*queueEntry{carol}, &queueEntry{client: &Client{ID: "carol"}}, nil},
+	} {
+		pool := NewPool()
+		pool.queues["5+3/standard"] = test.queue
+		if opponent := pool.findOpponent("5+3/standard", test.entry); opponent != test.expected {
+			t.Errorf("%v: expected %+v, got %+v", test.name, test.expected, opponent)
+		}
+	}
+}
+
+// TestMatchmaking checks that two clients joining the same queue are sent to the same new game.
+func TestMatchmaking(t *testing.T) {
+	pool := NewPool()
+	pool.Rooms = NewRooms()
+	defer pool.Rooms.Shutdown()
+	aliceConn, aliceRemote := testConn(t)
+	bobConn, bobRemote := testConn(t)
+	alice, bob := NewClient("alice", aliceConn, pool), NewClient("bob", bobConn, pool)
+	aliceMessages, bobMessages := listen(aliceRemote), listen(bobRemote)
+	defer alice.out.close()
+	defer bob.out.close()
+
+	pool.joinQueue(alice, Message{Type: 1, TimeControl: "fast"})
+	if message := aliceMessages.lobby(t, 1); message.Error == "" {
+		t.Errorf("expected an invalid time control to be rejected")
+	}
+	pool.joinQueue(alice, Message{Type: 1, TimeControl: "5+3"})
+	if message := aliceMessages.lobby(t, 1); message.QueueId != "5+3/standard" {
+		t.Errorf("expected alice to wait in the 5+3/standard queue, got %+v", message)
+	}
+	pool.leaveQueue(alice)
+	if len(pool.queues) != 0 {
+		t.Errorf("expected alice to leave the queue, got %v", pool.queues)
+	}
+
+	pool.joinQueue(alice, Message{Type: 1, TimeControl: "5+3"})
+	pool.joinQueue(bob, Message{Type: 1, TimeControl: "5+3"})
+	aliceFound, bobFound := aliceMessages.lobby(t, 3), bobMessages.lobby(t, 3)
+	if aliceFound.GameId == "" || aliceFound.Invite == "" || aliceFound != bobFound {
+		t.Fatalf("expected both clients to be sent the same game, got %+v and %+v", aliceFound, bobFound)
+	}
+	if len(pool.queues) != 0 {
+		t.Errorf("expected matched clients to leave the queue, got %v", pool.queues)
+	}
+	game, ok := pool.Rooms.Get(aliceFound.GameId)
+	if !ok {
+		t.Fatalf("expected game %v to be created", aliceFound.GameId)
+	}
+	if info := game.Info(); !info.Private || !info.Rated || info.TimeControl != "5+3" {
+		t.Errorf("expected a private rated 5+3 game, got %+v", info)
+	}
+}
+
+// TestReconnect checks that a player who drops can rejoin with their reconnect token within RECONNECT_GRACE.
+func TestReconnect(t *testing.T) {
+	grace := RECONNECT_GRACE
+	RECONNECT_GRACE = time.Minute
+	rooms := NewRooms()
+	defer func() {
+		rooms.Shutdown()
+		RECONNECT_GRACE = grace
+	}()
+	game, err := rooms.CreateGame(RoomOptions{Setup: "standard", Color: COLOR_WHITE, Creator: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, aliceRemote := gameClient(t, "alice", game)
+	bob, bobRemote := gameClient(t, "bob", game)
+	game.Join(alice)
+	game.Join(bob)
+	start := aliceRemote.game(t, 0)
+	bobRemote.game(t, 0)
+	if start.Color != WHITE || start.Reconnect == "" {
+		t.Fatalf("expected alice to play white with a reconnect token, got %+v", start)
+	}
+
+	game.Unregister <- alice
+	if left := bobRemote.game(t, 3); left.Pid != "alice" || left.Color != WHITE || left.Grace != 60 {
+		t.Errorf("expected bob to be told alice has 60 seconds to rejoin, got %+v", left)
+	}
+
+	intruder, intruderRemote := gameClient(t, "mallory", game)
+	intruder.Reconnect = "wrong"
+	game.Join(intruder)
+	if message := intruderRemote.game(t, 4); message.Color != SPECTATOR {
+		t.Errorf("expected a wrong reconnect token to only watch, got %+v", message)
+	}
+
+	thief, thiefRemote := gameClient(t, "mallory", game)
+	thief.Reconnect = start.Reconnect
+	game.Join(thief)
+	if message := thiefRemote.game(t, 0); message.Error == "" {
+		t.Errorf("expected the token of alice to be rejected for mallory, got %+v", message)
+	}
+	thiefRemote.waitClosed(t)
+
+	back, backRemote := gameClient(t, "alice", game)
+	back.Reconnect = start.Reconnect
+	game.Join(back)
+	if message := backRemote.game(t, 10); message.Color != WHITE || !message.GameStart || message.Pid != "bob" {
+		t.Errorf("expected alice to get white back, got %+v", message)
+	}
+	if message := bobRemote.game(t, 10); message.Pid != "alice" || message.Color != WHITE {
+		t.Errorf("expected bob to be told alice is back, got %+v", message)
+	}
+	if info := game.Info(); info.State != ROOM_PLAYING {
+		t.Errorf("expected the game to go on, got %+v", info)
+	}
+}
+
+// TestForfeit checks that a player who does not rejoin within RECONNECT_GRACE loses the game.
+func TestForfeit(t *testing.T) {
+	grace := RECONNECT_GRACE
+	RECONNECT_GRACE = 20 * time.Millisecond
+	rooms := NewRooms()
+	defer func() {
+		rooms.Shutdown()
+		RECONNECT_GRACE = grace
+	}()
+	game, err := rooms.CreateGame(RoomOptions{Setup: "standard", Color: COLOR_WHITE, Creator: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, _ := gameClient(t, "alice", game)
+	bob, bobRemote := gameClient(t, "bob", game)
+	game.Join(alice)
+	game.Join(bob)
+	bobRemote.game(t, 0)
+
+	game.Unregister <- alice
+	bobRemote.game(t, 3)
+	if end := bobRemote.game(t, 11); !end.GameEnd || end.Winner != BLACK || end.Reason != REASON_ABANDONED {
+		t.Errorf("expected black to win by abandonment, got %+v", end)
+	}
+	eventually(t, "the game to finish", func() bool {
+		return game.Info().State == ROOM_FINISHED
+	})
+}
+
+// TestOutboxEviction checks that a client falling SEND_QUEUE_SIZE messages behind is disconnected.
+func TestOutboxEviction(t *testing.T) {
+	conn, remote := testConn(t)
+	// without a writer goroutine, the queued messages are never written
+	out := &outbox{conn: conn, queue: make(chan []byte, SEND_QUEUE_SIZE)}
+	client := &GameClient{ID: "slow", Conn: conn, out: out}
+	if out.send(func() {}) {
+		t.Errorf("expected a message that cannot be encoded to be refused")
+	}
+	for i := 0; i < SEND_QUEUE_SIZE; i++ {
+		if !out.send(GameMessage{Type: 2, Message: "hello"}) {
+			t.Fatalf("expected message %d to be queued", i)
+		}
+	}
+	if out.send(GameMessage{Type: 2, Message: "hello"}) {
+		t.Errorf("expected a full outbox to refuse messages")
+	}
+
+	client.Send(GameMessage{Type: 2, Message: "hello"})
+	remote.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := remote.ReadMessage(); err == nil {
+		t.Errorf("expected no message to be written")
+	} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Errorf("expected an evicted client to be disconnected")
+	}
+
+	out.close()
+	if out.send(GameMessage{Type: 2, Message: "hello"}) {
+		t.Errorf("expected a closed outbox to refuse messages")
+	}
+}
+
+// TestOutboxHeartbeat checks that clients are pinged every PING_PERIOD, and dropped after PONG_WAIT of silence.
+func TestOutboxHeartbeat(t *testing.T) {
+	period, wait := PING_PERIOD, PONG_WAIT
+	PING_PERIOD, PONG_WAIT = 10*time.Millisecond, 50*time.Millisecond
+	defer func() {
+		PING_PERIOD, PONG_WAIT = period, wait
+	}()
+
+	conn, remote := testConn(t)
+	pings := make(chan struct{}, 1)
+	remote.SetPingHandler(func(string) error {
+		select {
+		case pings <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	out := newOutbox(conn)
+	done := drain(remote)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-pings:
+		case <-time.After(time.Second):
+			t.Fatalf("expected ping %d", i)
+		}
+	}
+	out.close()
+	<-done
+
+	// the remote never answers
+	conn, _ = testConn(t)
+	prepareRead(conn)
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Errorf("expected a silent client to be dropped")
+	} else if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Errorf("expected the read to time out, got %v", err)
+	}
+	conn.Close()
+}
+
+// TestRoomsLifecycle checks creating, finding, listing and closing rooms.
+func TestRoomsLifecycle(t *testing.T) {
+	retention := ROOM_RETENTION
+	ROOM_RETENTION = 50 * time.Millisecond
+	rooms := NewRooms()
+	defer func() {
+		rooms.Shutdown()
+		ROOM_RETENTION = retention
+	}()
+
+	for _, test := range []struct {
+		name    string
+		options RoomOptions
+		err     error // expected error, nil for any error
+	}{
+		{"unknown setup", RoomOptions{Setup: "unknown"}, nil},
+		{"invalid time control", RoomOptions{Setup: "standard", TimeControl: "fast"}, ErrInvalidTimeControl},
+		{"invalid color", RoomOptions{Setup: "standard", Color: "green"}, ErrInvalidColor},
+	} {
+		if _, err := rooms.CreateGame(test.options); err == nil || (test.err != nil && err != test.err) {
+			t.Errorf("%v: expected error %v, got %v", test.name, test.err, err)
+		}
+	}
+
+	public, err := rooms.CreateGame(RoomOptions{Setup: "standard"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := rooms.CreateGame(RoomOptions{Setup: "standard", Private: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := rooms.Get(strings.ToLower(public.ID)); !ok || got != public {
+		t.Errorf("expected to find room %v ignoring case", public.ID)
+	}
+	if public.Invite() != "" || private.Invite() == "" {
+		t.Errorf("expected only the private room to have an invite, got %q and %q", public.Invite(), private.Invite())
+	}
+	if list := rooms.List(false); len(list) != 1 || list[0].ID != public.ID {
+		t.Errorf("expected only the public room to be listed, got %+v", list)
+	}
+	if list := rooms.List(true); len(list) != 2 {
+		t.Errorf("expected both rooms to be listed, got %+v", list)
+	}
+	if info := private.Info(); info.State != ROOM_WAITING || !info.Private || info.Spectators {
+		t.Errorf("unexpected snapshot of a new private room: %+v", info)
+	}
+
+	private.Close()
+	<-private.done
+	if got, ok := rooms.Get(private.ID); !ok || got.Info().State != ROOM_ABANDONED {
+		t.Errorf("expected a room closed before its game to stay listed as abandoned, got %v", ok)
+	}
+	eventually(t, "the closed room to be removed", func() bool {
+		_, ok := rooms.Get(private.ID)
+		return !ok
+	})
+
+	rooms.Shutdown()
+	if list := rooms.List(true); len(list) != 0 {
+		t.Errorf("expected no room after a shutdown, got %+v", list)
+	}
+	if public.Join(&GameClient{ID: "late"}) {
+		t.Errorf("expected a closed room to refuse clients")
+	}
+}
+
+// TestRoomIdleTimeout checks that a room closes once it stays without clients for ROOM_IDLE_TIMEOUT.
+func TestRoomIdleTimeout(t *testing.T) {
+	timeout, retention := ROOM_IDLE_TIMEOUT, ROOM_RETENTION
+	ROOM_IDLE_TIMEOUT, ROOM_RETENTION = 100*time.Millisecond, 50*time.Millisecond
+	rooms := NewRooms()
+	conn, remote := testConn(t)
+	drain(remote)
+	game, err := rooms.CreateGame(RoomOptions{Setup: "standard"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		game.Close()
+		<-game.done
+		ROOM_IDLE_TIMEOUT, ROOM_RETENTION = timeout, retention
+	}()
+
+	client := NewGameClient("alice", conn, game)
+	game.Join(client)
+	time.Sleep(3 * ROOM_IDLE_TIMEOUT)
+	if _, ok := rooms.Get(game.ID); !ok {
+		t.Fatalf("expected a room with clients to stay open")
+	}
+	game.Unregister <- client
+	select {
+	case <-game.done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected an idle room to close")
+	}
+	if got, ok := rooms.Get(game.ID); !ok || got.Info().State != ROOM_ABANDONED {
+		t.Errorf("expected an idle room to stay listed as abandoned, got %v", ok)
+	}
+	eventually(t, "the idle room to be removed", func() bool {
+		_, ok := rooms.Get(game.ID)
+		return !ok
+	})
+}
+
+// TestInvites checks that only clients with the invite of a private room can play in it.
+func TestInvites(t *testing.T) {
+	rooms := NewRooms()
+	defer rooms.Shutdown()
+
+	for _, test := range []struct {
+		name       string
+		private    bool
+		spectators bool
+		invite     string // invite presented by the client, "valid" for the invite of the room
+		players    int    // 0 players and 0 watching when the client is rejected
+		watching   int
+	}{
+		{"public", false, false, "", 1, 0},
+		{"private with the invite", true, false, "valid", 1, 0},
+		{"private without invite", true, false, "", 0, 0},
+		{"private with a wrong invite", true, false, "wrong", 0, 0},
+		{"private open to spectators", true, true, "", 0, 1},
+	} {
+		game, err := rooms.CreateGame(RoomOptions{Setup: "standard", Private: test.private, Spectators: test.spectators})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, remote := gameClient(t, "alice", game)
+		client.Invite = test.invite
+		if test.invite == "valid" {
+			client.Invite = game.Invite()
+		}
+		game.Join(client)
+
+		if test.players == 0 && test.watching == 0 {
+			if message := remote.game(t, 0); message.Error == "" {
+				t.Errorf("%v: expected the client to be told why it is rejected", test.name)
+			}
+			remote.waitClosed(t)
+			continue
+		}
+		eventually(t, test.name, func() bool {
+			info := game.Info()
+			return info.Players == test.players && info.Watching == test.watching
+		})
+	}
+}
+
+// TestColorPreference checks that the creator of a room gets the color they asked for, whenever they join.
+func TestColorPreference(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		color   string
+		creator string
+		rated   bool
+		joins   []string // ids of the clients, in order of arrival
+		colors  []int    // colors they get
+	}{
+		{"creator first", COLOR_BLACK, "alice", false, []string{"alice", "bob"}, []int{BLACK, WHITE}},
+		{"creator second", COLOR_WHITE, "alice", false, []string{"bob", "alice"}, []int{BLACK, WHITE}},
+		{"no creator", COLOR_WHITE, "", false, []string{"bob", "alice"}, []int{WHITE, BLACK}},
+		{"seat kept for the creator", COLOR_WHITE, "alice", false, []string{"bob", "carol", "alice"},
+			[]int{BLACK, SPECTATOR, WHITE}},
+		{"rated against oneself", COLOR_WHITE, "", true, []string{"alice", "alice", "bob"},
+			[]int{WHITE, SPECTATOR, BLACK}},
+	} {
+		pool, err := NewGamePool("COLORS", "standard")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.ColorPreference = test.color
+		pool.Creator = test.creator
+		pool.Rated = test.rated
+		clients := make([]*GameClient, len(test.joins))
+		for i, id := range test.joins {
+			clients[i], _ = gameClient(t, id, pool)
+			assignInitialPlayers(pool, clients[i])
+		}
+		for i, client := range clients {
+			if color := pool.Clients[client]; color != test.colors[i] {
+				t.Errorf("%v: expected %v to get color %v, got %v", test.name, client.ID, test.colors[i], color)
+			}
+		}
+		if !pool.Start {
+			t.Errorf("%v: expected the game to start", test.name)
+		}
+		closeClients(pool)
+	}
+}
+
+// TestRematch checks that a rematch starts once both players offered it, with their colors swapped.
+func TestRematch(t *testing.T) {
+	pool, err := NewGamePool("REMATCH", "standard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeClients(pool)
+	pool.ColorPreference = COLOR_WHITE
+	pool.Creator = "alice"
+	alice, aliceRemote := gameClient(t, "alice", pool)
+	bob, bobRemote := gameClient(t, "bob", pool)
+	assignInitialPlayers(pool, alice)
+	assignInitialPlayers(pool, bob)
+	if pool.Players != [2]string{"alice", "bob"} {
+		t.Fatalf("expected alice to play white, got %v", pool.Players)
+	}
+
+	pool.offerRematch(alice)
+	if message := aliceRemote.game(t, 12); message.Error == "" {
+		t.Errorf("expected no rematch before the game is over")
+	}
+	pool.endGame(BLACK, REASON_ABANDONED)
+	pool.offerRematch(alice)
+	if offer := bobRemote.game(t, 12); offer.Pid != "alice" || offer.Color != WHITE {
+		t.Errorf("expected bob to be told of the offer of alice, got %+v", offer)
+	}
+	pool.offerRematch(bob)
+
+	if pool.Players != [2]string{"bob", "alice"} || pool.Over || pool.Rematches != 1 {
+		t.Errorf("expected a rematch with bob playing white, got %v, over %v, %v rematches", pool.Players, pool.Over,
+			pool.Rematches)
+	}
+	if start := aliceRemote.game(t, 0); start.Color != BLACK || start.White != "bob" || start.Rematch != 1 {
+		t.Errorf("expected alice to be told she plays black, got %+v", start)
+	}
+}
+
+// TestDrawHasNoWinner checks that a game drawn by repetition ends without a winner.
+func TestDrawHasNoWinner(t *testing.T) {
+	quantumchess.DEBUGAPPLYMOVE = false
+	pool, err := NewGamePool("DRAW", "standard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeClients(pool)
+	pool.ColorPreference = COLOR_WHITE
+	pool.Creator = "alice"
+	alice, aliceRemote := gameClient(t, "alice", pool)
+	bob, _ := gameClient(t, "bob", pool)
+	assignInitialPlayers(pool, alice)
+	assignInitialPlayers(pool, bob)
+
+	// the knights go out and come back until the position is repeated three times
+	moves := []GameMessage{{Type: 1, Move: [2]int{62, 45}}, {Type: 1, Move: [2]int{1, 18}},
+		{Type: 1, Move: [2]int{45, 62}}, {Type: 1, Move: [2]int{18, 1}}}
+	for i := 0; i < 4*len(moves) && !pool.Over; i++ {
+		player := alice
+		if i%2 == 1 {
+			player = bob
+		}
+		pool.playMove(player, moves[i%len(moves)])
+	}
+	update := aliceRemote.game(t, 1)
+	for !update.GameEnd {
+		update = aliceRemote.game(t, 1)
+	}
+	if update.Reason != quantumchess.REASON_REPETITION || update.Checkmate || update.Winner != -1 {
+		t.Errorf("expected a draw by repetition without a winner, got %+v", update)
+	}
+}